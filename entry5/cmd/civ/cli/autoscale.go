@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/autoscaler"
+	"github.com/spf13/cobra"
+)
+
+// NewAutoscaleCmd creates the autoscale command
+func NewAutoscaleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "autoscale",
+		Short: "Scale shop deployments from their stock and the buyers they turn away",
+		Long: `Sample the shops of a kingdom every interval and scale their deployments.
+A shop scales up when buyers get 409 Conflict responses faster than --starved-rate,
+and down when the stock of every product is above --surplus times its minimum for each worker.
+
+Shops created by the controller must leave spec.replicas unset, or the controller sets it back.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var opts autoscaler.Options
+			var err error
+			if opts.Kingdom, err = cmd.Flags().GetString("kingdom"); err != nil {
+				return err
+			}
+			if opts.Town, err = cmd.Flags().GetString("town"); err != nil {
+				return err
+			}
+			if opts.Interval, err = cmd.Flags().GetDuration("interval"); err != nil {
+				return err
+			}
+			if opts.MinReplicas, err = cmd.Flags().GetInt32("min-replicas"); err != nil {
+				return err
+			}
+			if opts.MaxReplicas, err = cmd.Flags().GetInt32("max-replicas"); err != nil {
+				return err
+			}
+			if opts.ScaleUpCooldown, err = cmd.Flags().GetDuration("scale-up-cooldown"); err != nil {
+				return err
+			}
+			if opts.ScaleDownCooldown, err = cmd.Flags().GetDuration("scale-down-cooldown"); err != nil {
+				return err
+			}
+			if opts.StarvedRate, err = cmd.Flags().GetFloat64("starved-rate"); err != nil {
+				return err
+			}
+			if opts.Surplus, err = cmd.Flags().GetFloat64("surplus"); err != nil {
+				return err
+			}
+			if opts.DryRun, err = cmd.Flags().GetBool("dry-run"); err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer cancel()
+
+			client, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+
+			slog.InfoContext(ctx, "starting autoscaler", "kingdom", opts.Kingdom, "town", opts.Town, "min_replicas", opts.MinReplicas, "max_replicas", opts.MaxReplicas)
+			return autoscaler.New(client, opts).Run(ctx)
+		},
+	}
+
+	cmd.Flags().String("kingdom", "", "Kingdom of the town")
+	cmd.Flags().String("town", "", "Name of the town, empty for every town in the kingdom")
+	cmd.Flags().Duration("interval", 0, "How often the shops are sampled (default 15s)")
+	cmd.Flags().Int32("min-replicas", 1, "Fewest workers a shop is scaled down to")
+	cmd.Flags().Int32("max-replicas", 10, "Most workers a shop is scaled up to")
+	cmd.Flags().Duration("scale-up-cooldown", 0, "Time after scaling a shop before it scales up again (default 1m)")
+	cmd.Flags().Duration("scale-down-cooldown", 0, "Time after scaling a shop before it scales down again (default 5m)")
+	cmd.Flags().Float64("starved-rate", 1, "Units per minute a shop turns away for lack of stock above which it scales up")
+	cmd.Flags().Float64("surplus", 3, "Scale down when every product is above this many times its minimum for each worker")
+	cmd.Flags().Bool("dry-run", false, "Log the scaling decisions without scaling")
+	cmd.MarkFlagRequired("kingdom")
+	cmd.RegisterFlagCompletionFunc("kingdom", KingdomsValidArgsFunction)
+	cmd.RegisterFlagCompletionFunc("town", TownsValidArgsFunction)
+
+	return cmd
+}
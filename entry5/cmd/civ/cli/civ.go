@@ -15,19 +15,58 @@ func NewCivCmd() *cobra.Command {
 		Short: "civ is a CLI tool for managing k8s resources",
 	}
 
+	cmd.PersistentFlags().String("kubeconfig", "", "Path to the kubeconfig file (defaults to $KUBECONFIG or ~/.kube/config)")
+	cmd.PersistentFlags().String("context", "", "Name of the kubeconfig context to use")
+
 	cmd.AddCommand(NewKingdomsCmd())
 	cmd.AddCommand(NewTownsCmd())
 	cmd.AddCommand(NewShopsCmd())
 	cmd.AddCommand(NewLogsCmd())
 	cmd.AddCommand(NewServeCmd())
 	cmd.AddCommand(NewWatchCmd())
+	cmd.AddCommand(NewControllerCmd())
+	cmd.AddCommand(NewDirectionsCmd())
+	cmd.AddCommand(NewGraphCmd())
+	cmd.AddCommand(NewPlanCmd())
+	cmd.AddCommand(NewAutoscaleCmd())
+	cmd.AddCommand(NewEventsCmd())
+	cmd.AddCommand(NewSimulateCmd())
 
 	return cmd
 }
 
+// clientOptions reads the kubernetes client options from the global civ flags
+func clientOptions(cmd *cobra.Command) (k8s.Options, error) {
+	kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+	if err != nil {
+		return k8s.Options{}, err
+	}
+	kubeContext, err := cmd.Flags().GetString("context")
+	if err != nil {
+		return k8s.Options{}, err
+	}
+	return k8s.Options{
+		Kubeconfig: kubeconfig,
+		Context:    kubeContext,
+	}, nil
+}
+
+// newClient builds the kubernetes client from the global civ flags
+func newClient(cmd *cobra.Command) (*k8s.Client, error) {
+	opts, err := clientOptions(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return k8s.NewClient(opts)
+}
+
 func KingdomsValidArgsFunction(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	client, err := newClient(cmd)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
 	ctx := context.Background()
-	kingdoms, err := k8s.ListNamespaces(ctx)
+	kingdoms, err := client.ListNamespaces(ctx)
 	if err != nil {
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	}
@@ -45,8 +84,12 @@ func TownsValidArgsFunction(cmd *cobra.Command, args []string, toComplete string
 	if kingdom == "" {
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	}
+	client, err := newClient(cmd)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
 	ctx := context.Background()
-	towns, err := k8s.ListDeployments(ctx, kingdom)
+	towns, err := client.ListDeployments(ctx, kingdom)
 	if err != nil {
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	}
@@ -65,8 +108,12 @@ func ShopsValidArgsFunction(cmd *cobra.Command, args []string, toComplete string
 	if kingdom == "" || town == "" {
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	}
+	client, err := newClient(cmd)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
 	ctx := context.Background()
-	shops, err := k8s.ListPods(ctx, kingdom, town)
+	shops, err := client.ListPods(ctx, kingdom, town)
 	if err != nil {
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	}
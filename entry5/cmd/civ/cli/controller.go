@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/auth"
+	"github.com/Potokar1/k8s-research/entry5/internal/controller"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/dynamic"
+)
+
+// NewControllerCmd creates the controller command
+func NewControllerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "controller",
+		Short: "Reconcile Kingdom, Town and Shop resources into a running kingdom",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workers, err := cmd.Flags().GetInt("workers")
+			if err != nil {
+				return err
+			}
+			image, err := cmd.Flags().GetString("worker-image")
+			if err != nil {
+				return err
+			}
+			resync, err := cmd.Flags().GetDuration("resync")
+			if err != nil {
+				return err
+			}
+			endpoint, err := cmd.Flags().GetString("otlp-endpoint")
+			if err != nil {
+				return err
+			}
+			workerAuth, err := cmd.Flags().GetString("worker-auth")
+			if err != nil {
+				return err
+			}
+			if _, err := auth.ParseMode(workerAuth); err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			client, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			dyn, err := dynamic.NewForConfig(client.RestConfig())
+			if err != nil {
+				return fmt.Errorf("failed to create dynamic client: %w", err)
+			}
+
+			c := controller.NewController(client.Interface(), dyn, controller.Options{
+				WorkerImage:  image,
+				Resync:       resync,
+				OTLPEndpoint: endpoint,
+				WorkerAuth:   workerAuth,
+			})
+			slog.InfoContext(ctx, "starting controller", "workers", workers, "worker_image", image)
+			return c.Run(ctx, workers)
+		},
+	}
+
+	cmd.Flags().Int("workers", 2, "Number of resources reconciled at the same time")
+	cmd.Flags().String("worker-image", controller.DefaultWorkerImage, "Image used for shop workers that don't set one")
+	cmd.Flags().Duration("resync", 0, "How often every resource is reconciled without changes (default 30s)")
+	cmd.Flags().String("otlp-endpoint", "", "OTLP/HTTP collector the shop workers send traces to (empty disables tracing)")
+	cmd.Flags().String("worker-auth", string(auth.ModeEnforce), "What the shop workers do with the service account tokens of their buyers: off, audit or enforce")
+
+	return cmd
+}
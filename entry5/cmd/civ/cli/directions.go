@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+	"github.com/spf13/cobra"
+)
+
+// NewDirectionsCmd creates the directions command
+func NewDirectionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "directions",
+		Short: "Work with worker directions files",
+	}
+
+	cmd.AddCommand(NewDirectionsValidateCmd())
+
+	return cmd
+}
+
+// NewDirectionsValidateCmd creates the directions validate command
+func NewDirectionsValidateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate <directions-file>...",
+		Short: "Validate directions files with the same checks a worker runs on startup",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			failed := 0
+			for _, file := range args {
+				directions, err := worker.ParseDirectionsFile(file)
+				if err != nil {
+					failed++
+					cmd.PrintErrf("%s: %v\n", file, err)
+					continue
+				}
+				cmd.Printf("%s: ok (%d directions)\n", file, len(directions))
+			}
+			if failed > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%d of %d directions files are invalid", failed, len(args))
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
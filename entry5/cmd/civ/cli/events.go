@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// NewEventsCmd creates the events command
+func NewEventsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "List and follow the events of the workers in a town",
+		Long: `List the Kubernetes Events the workers of a town record on their pods:
+Produced, PurchaseFailed, OutOfStock, BelowMinimum, Restocked and StoreUnavailable.
+With --follow new events are printed as they happen, like a town crier.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			kingdom, err := cmd.Flags().GetString("kingdom")
+			if err != nil {
+				return err
+			}
+			town, err := cmd.Flags().GetString("town")
+			if err != nil {
+				return err
+			}
+			follow, err := cmd.Flags().GetBool("follow")
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer cancel()
+
+			client, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			events, resourceVersion, err := client.ListWorkerEvents(ctx, kingdom, town)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			for _, event := range events {
+				printEvent(out, event)
+			}
+			if !follow {
+				return nil
+			}
+
+			watcher, err := client.WatchWorkerEvents(ctx, kingdom, resourceVersion)
+			if err != nil {
+				return err
+			}
+			defer watcher.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case update, ok := <-watcher.ResultChan():
+					if !ok {
+						return fmt.Errorf("event watch closed, run the command again to resume")
+					}
+					if update.Type != watch.Added && update.Type != watch.Modified {
+						continue // aggregated events are modified, deleted ones are only expired
+					}
+					event, ok := update.Object.(*corev1.Event)
+					if !ok || !k8s.InTown(*event, town) {
+						continue
+					}
+					printEvent(out, *event)
+				}
+			}
+		},
+	}
+
+	cmd.Flags().String("kingdom", "", "Kingdom of the town")
+	cmd.Flags().String("town", "", "Name of the town, empty for every town in the kingdom")
+	cmd.Flags().BoolP("follow", "f", false, "Print new events as they happen")
+	cmd.MarkFlagRequired("kingdom")
+	cmd.RegisterFlagCompletionFunc("kingdom", KingdomsValidArgsFunction)
+	cmd.RegisterFlagCompletionFunc("town", TownsValidArgsFunction)
+
+	return cmd
+}
+
+// printEvent prints an event on one line: time, shop, pod, reason and message, with the count if it repeated
+func printEvent(out io.Writer, event corev1.Event) {
+	count := ""
+	if event.Count > 1 {
+		count = fmt.Sprintf(" (x%d)", event.Count)
+	}
+	marker := " "
+	if event.Type == corev1.EventTypeWarning {
+		marker = "!"
+	}
+	fmt.Fprintf(out, "%s %s %-12s %-40s %-15s %s%s\n",
+		k8s.EventTime(event).Format("15:04:05"), marker,
+		event.Annotations[k8s.ShopLabel], event.InvolvedObject.Name,
+		event.Reason, event.Message, count)
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/town"
+	"github.com/spf13/cobra"
+)
+
+// NewGraphCmd creates the graph command
+func NewGraphCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Check the supply chain of a town and export it as a graph",
+		Long: `Build the producer/consumer graph of a town from the directions of its shops.
+The directions are read from the <shop>-directions ConfigMaps of the kingdom, or from a chart values file with --values.
+
+Cycles, inputs no shop produces and stores that point at missing services are reported,
+and the command fails if any are found.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := cmd.Flags().GetString("format")
+			if err != nil {
+				return err
+			}
+			shops, services, err := loadTown(cmd)
+			if err != nil {
+				return err
+			}
+
+			graph := town.NewGraph(shops, services)
+			switch format {
+			case "text":
+				for _, edge := range graph.Edges {
+					cmd.Printf("%s buys %d %s from %s\n", edge.Consumer, edge.Amount, edge.Product, edge.Store)
+				}
+			case "dot":
+				cmd.Print(graph.DOT())
+			case "mermaid":
+				cmd.Print(graph.Mermaid())
+			default:
+				return fmt.Errorf("unknown format %q, expected text, dot or mermaid", format)
+			}
+
+			issues := graph.Analyze()
+			for _, issue := range issues {
+				cmd.PrintErrln(issue.String())
+			}
+			if len(issues) > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("found %d supply chain issues", len(issues))
+			}
+			return nil
+		},
+	}
+
+	addTownSourceFlags(cmd)
+	cmd.Flags().String("format", "text", "Output format: text, dot or mermaid")
+
+	return cmd
+}
+
+// addTownSourceFlags adds the flags used to load the shops of a town from the cluster or a values file
+func addTownSourceFlags(cmd *cobra.Command) {
+	cmd.Flags().String("kingdom", "", "Kingdom of the town")
+	cmd.Flags().String("town", "", "Name of the town, empty for every town in the kingdom")
+	cmd.Flags().String("values", "", "Read the town from a chart values file instead of the cluster")
+	cmd.MarkFlagRequired("kingdom")
+	cmd.RegisterFlagCompletionFunc("kingdom", KingdomsValidArgsFunction)
+	cmd.RegisterFlagCompletionFunc("town", TownsValidArgsFunction)
+}
+
+// loadTown returns the shops of the town selected by the town source flags,
+// and the services of the kingdom those shops can buy from.
+func loadTown(cmd *cobra.Command) ([]town.Shop, []string, error) {
+	kingdom, err := cmd.Flags().GetString("kingdom")
+	if err != nil {
+		return nil, nil, err
+	}
+	townName, err := cmd.Flags().GetString("town")
+	if err != nil {
+		return nil, nil, err
+	}
+	valuesFile, err := cmd.Flags().GetString("values")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if valuesFile != "" {
+		kingdoms, err := town.ParseValuesFile(valuesFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		shops, err := town.FindTown(kingdoms, kingdom, townName)
+		if err != nil {
+			return nil, nil, err
+		}
+		// every shop of the kingdom has a service, not only the shops of the town
+		kingdomShops, err := town.FindTown(kingdoms, kingdom, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		return shops, town.Services(kingdomShops), nil
+	}
+
+	client, err := newClient(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	shops, err := town.LoadFromCluster(cmd.Context(), client, kingdom, townName)
+	if err != nil {
+		return nil, nil, err
+	}
+	services, err := client.ListServices(cmd.Context(), kingdom)
+	if err != nil {
+		return nil, nil, err
+	}
+	return shops, services, nil
+}
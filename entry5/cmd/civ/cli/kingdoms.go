@@ -3,7 +3,6 @@ package cli
 import (
 	"strings"
 
-	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
 	"github.com/spf13/cobra"
 )
 
@@ -14,8 +13,12 @@ func NewKingdomsCmd() *cobra.Command {
 		Short: "kingdoms is a CLI tool for managing k8s kingdoms",
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
 			// list kingdoms
-			kingdoms, err := k8s.ListNamespaces(cmd.Context())
+			kingdoms, err := client.ListNamespaces(cmd.Context())
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/town"
+	"github.com/spf13/cobra"
+)
+
+// NewPlanCmd creates the plan command
+func NewPlanCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Compute the steady state throughput of a town and recommend replicas",
+		Long: `Compute how fast every shop of a town produces and consumes, from the amounts and intervals in its directions.
+Rates are shown in units per minute. Demand assumes every consumer works at full capacity.
+
+Production is capped by the supply of the inputs, none at all for an input nothing supplies.
+The bottleneck is an input nothing supplies, else the shop whose products are most over-demanded, and the recommended replicas
+are the smallest number of workers that keep every downstream shop fed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			shops, _, err := loadTown(cmd)
+			if err != nil {
+				return err
+			}
+			plan := town.NewPlan(shops)
+
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "SHOP\tREPLICAS\tRECOMMENDED\tPRODUCES/MIN\tCONSUMES/MIN\tUTILIZATION")
+			for _, shop := range plan.Shops {
+				fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\n",
+					shop.Shop, shop.Replicas, shop.Recommended,
+					perMinute(shop.Production), perMinute(shop.Consumption), percent(shop.Utilization))
+			}
+			fmt.Fprintln(tw)
+			fmt.Fprintln(tw, "PRODUCT\tSUPPLY/MIN\tDEMAND/MIN")
+			for _, product := range slices.Sorted(maps.Keys(plan.Products)) {
+				flow := plan.Products[product]
+				fmt.Fprintf(tw, "%s\t%.2f\t%.2f\n", product, flow.Supply*60, flow.Demand*60)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+
+			switch {
+			case len(plan.Unsupplied) > 0:
+				cmd.Printf("\nBottleneck: %s, nothing supplies it\n", strings.Join(plan.Unsupplied, ", "))
+			case plan.Bottleneck == "":
+				cmd.Println("\nNo bottleneck, every shop keeps up with its consumers")
+			default:
+				cmd.Printf("\nBottleneck: %s\n", plan.Bottleneck)
+			}
+			return nil
+		},
+	}
+
+	addTownSourceFlags(cmd)
+
+	return cmd
+}
+
+// perMinute formats product rates as "10.00 wood, 1.50 iron"
+func perMinute(rates map[string]float64) string {
+	if len(rates) == 0 {
+		return "-"
+	}
+	var parts []string
+	for _, product := range slices.Sorted(maps.Keys(rates)) {
+		parts = append(parts, fmt.Sprintf("%.2f %s", rates[product]*60, product))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func percent(utilization float64) string {
+	if math.IsInf(utilization, 1) {
+		return "∞"
+	}
+	if utilization == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", utilization*100)
+}
@@ -5,14 +5,22 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/Potokar1/k8s-research/entry5/internal/auth"
+	"github.com/Potokar1/k8s-research/entry5/internal/clock"
+	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
 	"github.com/Potokar1/k8s-research/entry5/internal/server"
+	"github.com/Potokar1/k8s-research/entry5/internal/town"
+	"github.com/Potokar1/k8s-research/entry5/internal/tracing"
 	"github.com/Potokar1/k8s-research/entry5/internal/worker"
 	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
 )
 
 // NewServeCmd creates the serve command
@@ -26,10 +34,11 @@ func NewServeCmd() *cobra.Command {
 			ctx, cancelFunc := context.WithCancel(cmd.Context())
 			// go routine that listens for signals
 			sigs := make(chan os.Signal, 1)
-			signal.Notify(sigs, os.Interrupt)
+			// kubernetes stops the pod with SIGTERM, an interrupt comes from a terminal
+			signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 			go func() {
-				<-sigs
-				slog.InfoContext(ctx, "received interrupt signal, shutting down")
+				sig := <-sigs
+				slog.InfoContext(ctx, "received signal, shutting down", "signal", sig)
 				cancelFunc()
 			}()
 
@@ -50,18 +59,157 @@ func NewServeCmd() *cobra.Command {
 			name := os.Getenv("POD_NAME")
 			slog.InfoContext(ctx, "POD_NAME", "name", name)
 
-			worker := worker.NewWorker(namespace, name, directions)
-			go worker.Work(ctx)
+			endpoint, err := cmd.Flags().GetString("otlp-endpoint")
+			if err != nil {
+				return err
+			}
+			shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+				Endpoint:  endpoint,
+				Service:   os.Getenv("SHOP_NAME"),
+				Namespace: namespace,
+				Pod:       name,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to set up tracing: %w", err)
+			}
+			defer func() {
+				if err := shutdownTracing(context.Background()); err != nil {
+					slog.ErrorContext(ctx, "failed to flush traces", "error", err)
+				}
+			}()
+
+			opts, err := clientOptions(cmd)
+			if err != nil {
+				return err
+			}
+			opts.Namespace = namespace
+			client, err := k8s.NewClient(opts)
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			store, err := newInventoryStore(cmd, client, namespace, name)
+			if err != nil {
+				return err
+			}
+
+			coins, err := cmd.Flags().GetInt("coins")
+			if err != nil {
+				return err
+			}
+			var publishOpts worker.PublishOptions
+			if publishOpts.Interval, err = cmd.Flags().GetDuration("publish-interval"); err != nil {
+				return err
+			}
+			if publishOpts.Threshold, err = cmd.Flags().GetInt("publish-threshold"); err != nil {
+				return err
+			}
+
+			var schedule worker.ScheduleOptions
+			if schedule.Capacity, err = cmd.Flags().GetInt("capacity"); err != nil {
+				return err
+			}
+			if schedule.LaborTime, err = cmd.Flags().GetDuration("labor-time"); err != nil {
+				return err
+			}
+			policy, err := cmd.Flags().GetString("input-policy")
+			if err != nil {
+				return err
+			}
+			if schedule.InputPolicy, err = worker.ParseInputPolicy(policy); err != nil {
+				return err
+			}
+
+			speed, err := cmd.Flags().GetFloat64("speed")
+			if err != nil {
+				return err
+			}
+			workerClock, err := clock.NewScaled(speed)
+			if err != nil {
+				return err
+			}
+
+			worker := worker.NewWorker(namespace, name, directions, coins, store)
+			worker.SetClock(workerClock)
+			worker.SetDiscovery(town.NewClusterDiscovery(client, namespace, os.Getenv("SHOP_NAME")))
+			callbackURL, err := cmd.Flags().GetString("callback-url")
+			if err != nil {
+				return err
+			}
+			worker.SetCallbackURL(callbackURL)
+			tokenFile, err := cmd.Flags().GetString("token-file")
+			if err != nil {
+				return err
+			}
+			if tokenFile != "" {
+				worker.SetTokenFile(auth.NewTokenFile(tokenFile))
+			}
+			// events are best effort, a worker outside of a pod still works without them
+			recorder, err := client.NewPodEventRecorder(ctx, namespace, name)
+			if err != nil {
+				slog.WarnContext(ctx, "failed to create event recorder, events are disabled", "error", err)
+			} else {
+				defer recorder.Shutdown()
+				worker.SetEventRecorder(recorder)
+			}
+			// rehydrate the inventory before selling anything
+			if err := worker.Restore(ctx); err != nil {
+				slog.ErrorContext(ctx, "failed to restore inventory, starting empty", "error", err)
+			}
+			// the jobs stop with the context, shutdown waits for the one in flight before the last save
+			workDone := make(chan struct{})
+			go func() {
+				defer close(workDone)
+				worker.Work(ctx, schedule)
+			}()
+			// the publisher outlives the server, so sales still in flight at shutdown are saved
+			publishCtx, stopPublish := context.WithCancel(context.WithoutCancel(ctx))
+			defer stopPublish()
+			publishDone := make(chan struct{})
+			go func() {
+				defer close(publishDone)
+				worker.Publish(publishCtx, publishOpts)
+			}()
 
 			// create the server
 			s := server.NewServer(worker)
+			authenticator, err := newAuthenticator(cmd, client)
+			if err != nil {
+				return err
+			}
+			s.SetAuthenticator(authenticator)
 			mux := http.DefaultServeMux
 			s.InitializeREST(ctx, mux)
+			if err := s.InitializeMetrics(mux); err != nil {
+				return fmt.Errorf("failed to register metrics: %w", err)
+			}
 
 			srv := &http.Server{
 				Handler: mux,
 				Addr:    ":8080",
 			}
+			srv.RegisterOnShutdown(s.Shutdown)
+
+			// the Shop service for the stores buying over gRPC
+			grpcAddr, err := cmd.Flags().GetString("grpc-addr")
+			if err != nil {
+				return err
+			}
+			grpcSrv := grpc.NewServer()
+			s.InitializeGRPC(grpcSrv)
+			if grpcAddr != "" {
+				listener, err := net.Listen("tcp", grpcAddr)
+				if err != nil {
+					return fmt.Errorf("failed to listen for gRPC: %w", err)
+				}
+				go func() {
+					slog.InfoContext(ctx, "Listening for gRPC", "addr", grpcAddr)
+					if err := grpcSrv.Serve(listener); err != nil {
+						slog.ErrorContext(ctx, "gRPC serve failed", "error", err)
+						panic(err)
+					}
+				}()
+			}
 
 			go func() {
 				slog.InfoContext(ctx, "Listening", "addr", srv.Addr)
@@ -83,10 +231,101 @@ func NewServeCmd() *cobra.Command {
 			if err := srv.Shutdown(timeoutCtx); err != nil {
 				return fmt.Errorf("server shutdown failed: %w", err)
 			}
+			grpcSrv.GracefulStop()
+			select {
+			case <-workDone:
+			case <-timeoutCtx.Done():
+				slog.ErrorContext(ctx, "jobs did not stop in time, their last changes may be lost")
+			}
+			// save the last changes
+			stopPublish()
+			<-publishDone
+			// hand the ledger over to the worker replacing this one
+			if err := worker.Release(timeoutCtx); err != nil {
+				slog.ErrorContext(ctx, "failed to release the ledger", "error", err)
+			}
 
 			return nil
 		},
 	}
 
+	cmd.Flags().Int("coins", 1000, "Coins in the wallet of a new worker")
+	cmd.Flags().String("inventory-store", "annotations", "Where the inventory is persisted: annotations, configmap or file")
+	cmd.Flags().String("inventory-file", "/data/inventory.json", "Path of the inventory file when --inventory-store=file")
+	cmd.Flags().Duration("publish-interval", time.Second, "Longest an inventory change waits before it is saved")
+	cmd.Flags().Int("publish-threshold", 20, "Number of inventory changes that are saved right away")
+	cmd.Flags().Int("capacity", 0, "Number of jobs the worker runs at once, 0 runs every direction at once")
+	cmd.Flags().Duration("labor-time", worker.DefaultLaborTime, "How long a job (buying an input or producing) keeps the worker busy")
+	cmd.Flags().String("input-policy", string(worker.InputPolicyFirstCome), "Which direction gets an input several directions need: first-come or priority")
+	cmd.Flags().String("grpc-addr", ":"+worker.DefaultGRPCPort, "Address of the gRPC Shop service, empty disables it")
+	cmd.Flags().String("callback-url", defaultCallbackURL(), "URL the stores post settled standing orders to (empty makes the worker poll them)")
+	cmd.Flags().String("auth", string(auth.ModeOff), "What the worker does with the service account tokens of its buyers: off, audit (log who would be turned away) or enforce")
+	cmd.Flags().StringSlice("auth-kingdoms", nil, "Kingdoms whose shops may buy, empty allows every kingdom")
+	cmd.Flags().StringSlice("auth-shops", nil, "Shops that may buy, such as craftsman, empty allows every shop")
+	cmd.Flags().String("token-file", auth.DefaultTokenFile, "Service account token sent to the stores the worker buys from (empty sends none)")
+	cmd.Flags().Float64("speed", 1, "Time dilation of the worker: at 10 every interval passes 10 times as fast")
+	cmd.Flags().String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/HTTP collector the traces are sent to, such as http://otel-collector:4318 (empty disables tracing)")
+
 	return cmd
 }
+
+// newInventoryStore creates the store selected by the --inventory-store flag.
+// The pod annotations are always written so `civ watch` keeps working.
+func newInventoryStore(cmd *cobra.Command, client *k8s.Client, namespace, name string) (worker.InventoryStore, error) {
+	kind, err := cmd.Flags().GetString("inventory-store")
+	if err != nil {
+		return nil, err
+	}
+	annotations := worker.NewAnnotationStore(client, namespace, name)
+
+	switch kind {
+	case "annotations":
+		return annotations, nil
+	case "configmap":
+		shop := os.Getenv("SHOP_NAME")
+		if shop == "" {
+			return nil, fmt.Errorf("SHOP_NAME must be set to use the configmap inventory store")
+		}
+		return worker.MultiStore{worker.NewConfigMapStore(client, namespace, shop, name), annotations}, nil
+	case "file":
+		path, err := cmd.Flags().GetString("inventory-file")
+		if err != nil {
+			return nil, err
+		}
+		return worker.MultiStore{worker.NewFileStore(path), annotations}, nil
+	default:
+		return nil, fmt.Errorf("unknown inventory store %q", kind)
+	}
+}
+
+// newAuthenticator creates the authenticator of the --auth flags, nil when auth is off
+func newAuthenticator(cmd *cobra.Command, client *k8s.Client) (*auth.Authenticator, error) {
+	flag, err := cmd.Flags().GetString("auth")
+	if err != nil {
+		return nil, err
+	}
+	mode, err := auth.ParseMode(flag)
+	if err != nil {
+		return nil, err
+	}
+	if mode == auth.ModeOff {
+		return nil, nil
+	}
+	var policy auth.Policy
+	if policy.Kingdoms, err = cmd.Flags().GetStringSlice("auth-kingdoms"); err != nil {
+		return nil, err
+	}
+	if policy.Shops, err = cmd.Flags().GetStringSlice("auth-shops"); err != nil {
+		return nil, err
+	}
+	return auth.NewAuthenticator(client.Interface().AuthenticationV1().TokenReviews(), client.Interface().CoreV1(), mode, policy), nil
+}
+
+// defaultCallbackURL reaches the deliveries endpoint of this very pod, a Service could route the callback to another replica
+func defaultCallbackURL() string {
+	ip := os.Getenv("POD_IP")
+	if ip == "" {
+		return ""
+	}
+	return "http://" + net.JoinHostPort(ip, "8080") + "/api/v2/deliveries"
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
 	"github.com/spf13/cobra"
 )
 
@@ -23,7 +22,11 @@ func NewShopsCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			shops, err := k8s.ListPods(context.Background(), kingdom, townName)
+			client, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			shops, err := client.ListPods(context.Background(), kingdom, townName)
 			if err != nil {
 				return err
 			}
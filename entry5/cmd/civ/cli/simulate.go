@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/sim"
+	"github.com/Potokar1/k8s-research/entry5/internal/town"
+	"github.com/spf13/cobra"
+)
+
+// NewSimulateCmd creates the simulate command
+func NewSimulateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "simulate <values.yaml>",
+		Short: "Run the economy of a chart values file in-process, without a cluster",
+		Long: `Run one worker for every replica of every shop in the values file, in a single process.
+Workers buy from each other through in-memory transports instead of cluster DNS, and nothing is saved to Kubernetes.
+
+Time is virtual: it jumps straight to the next production, so an hour of economy runs in moments,
+and the same values always give the same result.
+
+The output is a time series of the inventories, one row per worker and product at every sample,
+as CSV (time,kingdom,town,shop,worker,product,amount) or as JSON lines with the full ledger of every worker.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			kingdomName, err := cmd.Flags().GetString("kingdom")
+			if err != nil {
+				return err
+			}
+			townName, err := cmd.Flags().GetString("town")
+			if err != nil {
+				return err
+			}
+			duration, err := cmd.Flags().GetDuration("duration")
+			if err != nil {
+				return err
+			}
+			interval, err := cmd.Flags().GetDuration("sample")
+			if err != nil {
+				return err
+			}
+			format, err := cmd.Flags().GetString("format")
+			if err != nil {
+				return err
+			}
+			verbose, err := cmd.Flags().GetBool("verbose")
+			if err != nil {
+				return err
+			}
+
+			kingdoms, err := town.ParseValuesFile(args[0])
+			if err != nil {
+				return err
+			}
+			if kingdomName != "" {
+				kingdoms = slices.DeleteFunc(kingdoms, func(k town.Kingdom) bool { return k.Name != kingdomName })
+				if len(kingdoms) == 0 {
+					return fmt.Errorf("kingdom %q not found in %s", kingdomName, args[0])
+				}
+			}
+
+			// every worker logs each production, which buries the output of a fast simulation
+			if !verbose {
+				slog.SetDefault(slog.New(slog.NewTextHandler(cmd.ErrOrStderr(), &slog.HandlerOptions{Level: slog.LevelWarn})))
+			}
+
+			simulation, err := sim.New(kingdoms, townName)
+			if err != nil {
+				return err
+			}
+
+			var sample func(sim.Sample) error
+			switch format {
+			case "csv":
+				out := csv.NewWriter(cmd.OutOrStdout())
+				defer out.Flush()
+				if err := out.Write([]string{"time", "kingdom", "town", "shop", "worker", "product", "amount"}); err != nil {
+					return err
+				}
+				sample = func(s sim.Sample) error {
+					at := strconv.FormatFloat(s.Time.Seconds(), 'f', -1, 64)
+					for _, w := range s.Workers {
+						for _, product := range slices.Sorted(maps.Keys(w.Ledger.Inventory)) {
+							amount := strconv.Itoa(w.Ledger.Inventory[product])
+							if err := out.Write([]string{at, w.Kingdom, w.Town, w.Shop, w.Worker, product, amount}); err != nil {
+								return err
+							}
+						}
+					}
+					out.Flush()
+					return out.Error()
+				}
+			case "json":
+				out := json.NewEncoder(cmd.OutOrStdout())
+				sample = func(s sim.Sample) error {
+					// seconds read better than the nanoseconds of a marshaled duration
+					return out.Encode(struct {
+						Time    float64            `json:"time"`
+						Workers []sim.WorkerSample `json:"workers"`
+					}{s.Time.Seconds(), s.Workers})
+				}
+			default:
+				return fmt.Errorf("unknown format %q, use csv or json", format)
+			}
+
+			ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer cancel()
+			return simulation.Run(ctx, duration, interval, sample)
+		},
+	}
+
+	cmd.Flags().String("kingdom", "", "Only simulate this kingdom, empty for every kingdom in the values")
+	cmd.Flags().String("town", "", "Only simulate this town, empty for every town")
+	cmd.Flags().Duration("duration", 10*time.Minute, "Virtual time to run the economy for")
+	cmd.Flags().Duration("sample", 10*time.Second, "Virtual time between two samples of the inventories")
+	cmd.Flags().String("format", "csv", "Output format: csv or json")
+	cmd.Flags().Bool("verbose", false, "Log every production and sale of the workers to stderr")
+
+	return cmd
+}
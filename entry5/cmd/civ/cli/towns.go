@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
 	"github.com/spf13/cobra"
 )
 
@@ -19,7 +18,11 @@ func NewTownsCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			towns, err := k8s.ListDeployments(context.Background(), kingdom)
+			client, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			towns, err := client.ListDeployments(context.Background(), kingdom)
 			if err != nil {
 				return err
 			}
@@ -1,15 +1,23 @@
 package cli
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"sort"
-	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
+	"github.com/Potokar1/k8s-research/entry5/internal/server"
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
 	"github.com/spf13/cobra"
 )
 
@@ -29,12 +37,20 @@ func NewWatchCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			direct, err := cmd.Flags().GetBool("direct")
+			if err != nil {
+				return err
+			}
 
 			// start watching k8s, feed into watcher
 			ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt)
 			defer cancel()
 
-			updates, err := k8s.WatchPods(ctx, kingdom, town)
+			client, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			updates, err := client.WatchPods(ctx, kingdom, town)
 			if err != nil {
 				return err
 			}
@@ -43,8 +59,20 @@ func NewWatchCmd() *cobra.Command {
 
 			// fan-in updates to the watcher
 			go func() {
+				if direct {
+					w.streamPods(ctx, client, kingdom, updates)
+					return
+				}
 				for update := range updates {
-					w.update(update.PodName, update.Inventory)
+					switch update.Type {
+					case k8s.PodAdded, k8s.PodUpdated:
+						if update.Err != nil || update.Inventory == nil {
+							continue // the worker has not published a readable inventory yet
+						}
+						w.update(update.PodName, update.Inventory)
+					case k8s.PodDeleted:
+						w.remove(update.PodName)
+					}
 				}
 			}()
 
@@ -66,6 +94,7 @@ func NewWatchCmd() *cobra.Command {
 
 	cmd.Flags().String("kingdom", "", "Kingdom of the town")
 	cmd.Flags().String("town", "", "Name of the town")
+	cmd.Flags().Bool("direct", false, "Port-forward to every worker and follow its /events stream, instead of the inventory annotations")
 	cmd.MarkFlagRequired("kingdom")
 	cmd.RegisterFlagCompletionFunc("kingdom", KingdomsValidArgsFunction)
 	cmd.RegisterFlagCompletionFunc("town", TownsValidArgsFunction)
@@ -79,12 +108,16 @@ type watcher struct {
 }
 
 type podHelper struct {
-	inventory map[string]int // product → amount
-	diff      map[string]int // product → delta since last update
-	changedAt changedAt      // product → time of last change
+	sequence     int64                // sequence of the last document, older documents are dropped
+	wallet       int                  // coins in the wallet of the worker
+	prices       map[string]int       // product → price
+	inventory    map[string]int       // product → amount
+	lastProduced map[string]time.Time // product → time it was last made
+	diff         map[string]int       // product → delta since last update
+	changedAt    changedAt            // product → time of last change
 }
 
-func (w *watcher) update(podName string, inventory map[string]string) {
+func (w *watcher) update(podName string, doc *k8s.InventoryDocument) {
 	w.Lock()
 	defer w.Unlock()
 
@@ -97,14 +130,16 @@ func (w *watcher) update(podName string, inventory map[string]string) {
 		ph.inventory = make(map[string]int)
 		ph.diff = make(map[string]int)
 		ph.changedAt = make(changedAt)
+	} else if doc.Sequence < ph.sequence {
+		return // a resync or a late event, we already show something newer
 	}
+	ph.sequence = doc.Sequence
+	ph.wallet = doc.Wallet
+	ph.prices = doc.Prices
+	ph.lastProduced = doc.LastProduced
 
 	now := time.Now()
-	for product, amountStr := range inventory {
-		newAmount, err := strconv.Atoi(amountStr)
-		if err != nil {
-			continue
-		}
+	for product, newAmount := range doc.Inventory {
 		oldAmount := ph.inventory[product]
 		// only update if the amount has changed
 		if newAmount != oldAmount {
@@ -113,7 +148,172 @@ func (w *watcher) update(podName string, inventory map[string]string) {
 		}
 		ph.inventory[product] = newAmount
 	}
+	// products that are no longer in the document are gone
+	for product := range ph.inventory {
+		if _, ok := doc.Inventory[product]; !ok {
+			delete(ph.inventory, product)
+			delete(ph.diff, product)
+			delete(ph.changedAt, product)
+		}
+	}
+	w.pod[podName] = ph
+}
+
+// streamPods follows the /events stream of every pod the updates add, until the pod is deleted
+func (w *watcher) streamPods(ctx context.Context, client *k8s.Client, namespace string, updates <-chan k8s.PodEvent) {
+	streams := make(map[string]context.CancelFunc)
+	defer func() {
+		for _, cancel := range streams {
+			cancel()
+		}
+	}()
+	for update := range updates {
+		switch update.Type {
+		case k8s.PodAdded, k8s.PodUpdated:
+			if _, ok := streams[update.PodName]; ok {
+				continue
+			}
+			podCtx, cancel := context.WithCancel(ctx)
+			streams[update.PodName] = cancel
+			go w.streamPod(podCtx, client, namespace, update.PodName)
+		case k8s.PodDeleted:
+			if cancel, ok := streams[update.PodName]; ok {
+				cancel()
+				delete(streams, update.PodName)
+			}
+			w.remove(update.PodName)
+		}
+	}
+}
+
+// streamPod follows the /events stream of a pod through a port-forward, reconnecting with the last event ID when it breaks
+func (w *watcher) streamPod(ctx context.Context, client *k8s.Client, namespace, podName string) {
+	lastEventID := ""
+	for ctx.Err() == nil {
+		if err := w.followEvents(ctx, client, namespace, podName, &lastEventID); err != nil && ctx.Err() == nil {
+			slog.Debug("event stream broke, reconnecting", "pod", podName, "error", err)
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// followEvents reads the event stream of a pod until it ends, keeping the ID of the last event read
+func (w *watcher) followEvents(ctx context.Context, client *k8s.Client, namespace, podName string, lastEventID *string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	port, forwarded, err := client.PortForward(ctx, namespace, podName, 8080)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-forwarded
+		cancel() // the forward broke, so does the stream
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://localhost:%d/events", port), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *lastEventID != "" {
+		req.Header.Set("Last-Event-ID", *lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("worker answered %s", resp.Status)
+	}
+
+	// an event is its id, event and data lines, ended by a blank line. Lines starting with a colon are comments.
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	var id, kind, data string
+	for scanner.Scan() {
+		field, value, _ := strings.Cut(scanner.Text(), ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			kind = value
+		case "data":
+			data += value
+		case "":
+			if data != "" {
+				if err := w.apply(podName, kind, []byte(data)); err != nil {
+					return err
+				}
+				*lastEventID = id
+			}
+			kind, data = "", ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// apply updates a pod from an event of its stream
+func (w *watcher) apply(podName, kind string, data []byte) error {
+	if kind == server.EventSnapshot {
+		var ledger worker.Ledger
+		if err := json.Unmarshal(data, &ledger); err != nil {
+			return fmt.Errorf("bad snapshot: %w", err)
+		}
+		w.update(podName, &k8s.InventoryDocument{
+			Inventory:    ledger.Inventory,
+			Wallet:       ledger.Wallet,
+			Prices:       ledger.Prices,
+			LastProduced: ledger.LastProduced,
+		})
+		return nil
+	}
+
+	var event worker.StreamEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return fmt.Errorf("bad event: %w", err)
+	}
+	w.Lock()
+	defer w.Unlock()
+	ph, ok := w.pod[podName]
+	if !ok {
+		return nil // events only change a snapshot
+	}
+	ph.wallet = event.Wallet
+	switch event.Kind {
+	case worker.StreamInventory:
+		// stock is absolute, so an event already in the snapshot changes nothing
+		if old := ph.inventory[event.Product]; old != event.Stock {
+			ph.diff[event.Product] = event.Stock - old
+			ph.changedAt[event.Product] = time.Now()
+		}
+		if event.Stock == 0 {
+			delete(ph.inventory, event.Product)
+		} else {
+			ph.inventory[event.Product] = event.Stock
+		}
+	case worker.StreamProduced:
+		if ph.lastProduced == nil {
+			ph.lastProduced = make(map[string]time.Time)
+		}
+		ph.lastProduced[event.Product] = event.Time
+	}
 	w.pod[podName] = ph
+	return nil
+}
+
+// remove forgets a pod that was deleted
+func (w *watcher) remove(podName string) {
+	w.Lock()
+	defer w.Unlock()
+	delete(w.pod, podName)
 }
 
 func (w *watcher) render() {
@@ -133,7 +333,7 @@ func (w *watcher) render() {
 	// render each pod once, then its inventory
 	for _, podName := range pods {
 		ph := w.pod[podName]
-		fmt.Println(podName)
+		fmt.Printf("%s (%d coins)\n", podName, ph.wallet)
 
 		// sort products for stable output
 		prods := make([]string, 0, len(ph.inventory))
@@ -147,7 +347,15 @@ func (w *watcher) render() {
 			delta := ph.diff[prod]
 			age := time.Since(ph.changedAt[prod])
 			cell := createCell(amt-delta, amt, age)
-			fmt.Printf("  %-20s %s\n", prod, cell)
+			price := ""
+			if p, ok := ph.prices[prod]; ok {
+				price = fmt.Sprintf("$%d", p)
+			}
+			made := ""
+			if t, ok := ph.lastProduced[prod]; ok {
+				made = fmt.Sprintf("made %s ago", time.Since(t).Round(time.Second))
+			}
+			fmt.Printf("  %-20s %6s %s  %s\n", prod, price, cell, made)
 		}
 		fmt.Println()
 	}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
 	"github.com/spf13/cobra"
 )
 
@@ -27,7 +26,11 @@ func NewLogsCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			logs, err := k8s.GetContainerLogs(context.Background(), kingdom, shopName)
+			client, err := newClient(cmd)
+			if err != nil {
+				return err
+			}
+			logs, err := client.GetContainerLogs(context.Background(), kingdom, shopName)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,103 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Group   = "civ.k8s-research"
+	Version = "v1alpha1"
+)
+
+// GroupVersion is the group and version of the civ custom resources
+var GroupVersion = schema.GroupVersion{Group: Group, Version: Version}
+
+// Resources served by the civ CustomResourceDefinitions
+var (
+	KingdomResource = GroupVersion.WithResource("kingdoms")
+	TownResource    = GroupVersion.WithResource("towns")
+	ShopResource    = GroupVersion.WithResource("shops")
+)
+
+// Kingdom is a cluster scoped resource that owns the namespace of the same name.
+// Everything that lives in the kingdom (towns, shops, workers) lives in that namespace.
+type Kingdom struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KingdomSpec   `json:"spec,omitempty"`
+	Status KingdomStatus `json:"status,omitempty"`
+}
+
+type KingdomSpec struct{}
+
+type KingdomStatus struct {
+	Towns []string `json:"towns,omitempty"` // Towns is the list of towns found in the kingdom
+}
+
+// Town is a namespaced resource that groups the shops of a kingdom together
+type Town struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TownSpec   `json:"spec,omitempty"`
+	Status TownStatus `json:"status,omitempty"`
+}
+
+type TownSpec struct{}
+
+type TownStatus struct {
+	Shops []string `json:"shops,omitempty"` // Shops is the list of shops that belong to the town
+}
+
+// Shop is a namespaced resource that is reconciled into the directions ConfigMap,
+// the worker Deployment and the Service other shops buy from.
+type Shop struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ShopSpec   `json:"spec,omitempty"`
+	Status ShopStatus `json:"status,omitempty"`
+}
+
+type ShopSpec struct {
+	Town           string      `json:"town"`                     // Town is the name of the town the shop belongs to
+	Replicas       *int32      `json:"replicas,omitempty"`       // Replicas is the number of workers in the shop, nil leaves it to civ autoscale
+	Image          string      `json:"image,omitempty"`          // Image overrides the worker image used by the controller
+	Coins          *int        `json:"coins,omitempty"`          // Coins is the starting wallet of every worker
+	InventoryStore string      `json:"inventoryStore,omitempty"` // InventoryStore is where workers persist their inventory: annotations, configmap or file
+	Directions     []Direction `json:"directions,omitempty"`
+	AllowKingdoms  []string    `json:"allowKingdoms,omitempty"` // AllowKingdoms are the kingdoms whose shops may buy, empty for every kingdom
+	AllowShops     []string    `json:"allowShops,omitempty"`    // AllowShops are the shops that may buy, empty for every shop
+}
+
+type ShopStatus struct {
+	Replicas      int32              `json:"replicas,omitempty"`      // Replicas is the number of workers created for the shop
+	ReadyReplicas int32              `json:"readyReplicas,omitempty"` // ReadyReplicas is the number of workers above their minimum
+	Conditions    []metav1.Condition `json:"conditions,omitempty"`    // Conditions tell whether the spec could be rolled out, see ShopConditionDirectionsValid
+}
+
+// ShopConditionDirectionsValid is true when the directions of the shop pass the validation of the workers.
+// Invalid directions are not rolled out, the workers keep the last valid ones.
+const ShopConditionDirectionsValid = "DirectionsValid"
+
+// Direction mirrors the worker directions found in the chart values
+type Direction struct {
+	Product          string         `json:"product"`
+	ProductInputList []ProductInput `json:"productInputList,omitempty"`
+	Amount           int            `json:"amount"`
+	Minimum          int            `json:"minimum,omitempty"`
+	Interval         int            `json:"interval"`
+	Price            int            `json:"price,omitempty"`
+}
+
+type ProductInput struct {
+	Product  string   `json:"product"`
+	Store    string   `json:"store,omitempty"`
+	Stores   []string `json:"stores,omitempty"`
+	Discover bool     `json:"discover,omitempty"`
+	Strategy string   `json:"strategy,omitempty"`
+	Standing bool     `json:"standing,omitempty"`
+	Amount   int      `json:"amount"`
+}
@@ -0,0 +1,292 @@
+// The Shop service is what a worker (shop replica) serves to other shops over gRPC, next to its REST API.
+// Regenerate the Go code with `make proto`.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.3
+// source: internal/apis/shop/v1/shop.proto
+
+package shopv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Shop_Sell_FullMethodName            = "/civ.shop.v1.Shop/Sell"
+	Shop_GetInventory_FullMethodName    = "/civ.shop.v1.Shop/GetInventory"
+	Shop_StreamInventory_FullMethodName = "/civ.shop.v1.Shop/StreamInventory"
+	Shop_PlaceOrder_FullMethodName      = "/civ.shop.v1.Shop/PlaceOrder"
+	Shop_GetOrder_FullMethodName        = "/civ.shop.v1.Shop/GetOrder"
+)
+
+// ShopClient is the client API for Shop service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ShopClient interface {
+	// Sell sells products right away or not at all, like POST /sell.
+	// Out of stock is RESOURCE_EXHAUSTED, a payment that doesn't cover the total is FAILED_PRECONDITION.
+	Sell(ctx context.Context, in *SellRequest, opts ...grpc.CallOption) (*SellResponse, error)
+	// GetInventory returns the stock and price of every product the worker has or makes, like GET /api/v2/inventory.
+	GetInventory(ctx context.Context, in *GetInventoryRequest, opts ...grpc.CallOption) (*GetInventoryResponse, error)
+	// StreamInventory streams the changes of the worker, like GET /events. It starts with a snapshot unless it resumes.
+	StreamInventory(ctx context.Context, in *StreamInventoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[InventoryEvent], error)
+	// PlaceOrder places an order, like POST /api/v2/orders. A standing order the worker doesn't make is NOT_FOUND.
+	PlaceOrder(ctx context.Context, in *PlaceOrderRequest, opts ...grpc.CallOption) (*Order, error)
+	// GetOrder returns an order, for buyers polling a standing order. An order the worker doesn't know is NOT_FOUND.
+	GetOrder(ctx context.Context, in *GetOrderRequest, opts ...grpc.CallOption) (*Order, error)
+}
+
+type shopClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewShopClient(cc grpc.ClientConnInterface) ShopClient {
+	return &shopClient{cc}
+}
+
+func (c *shopClient) Sell(ctx context.Context, in *SellRequest, opts ...grpc.CallOption) (*SellResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SellResponse)
+	err := c.cc.Invoke(ctx, Shop_Sell_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shopClient) GetInventory(ctx context.Context, in *GetInventoryRequest, opts ...grpc.CallOption) (*GetInventoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetInventoryResponse)
+	err := c.cc.Invoke(ctx, Shop_GetInventory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shopClient) StreamInventory(ctx context.Context, in *StreamInventoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[InventoryEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Shop_ServiceDesc.Streams[0], Shop_StreamInventory_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamInventoryRequest, InventoryEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Shop_StreamInventoryClient = grpc.ServerStreamingClient[InventoryEvent]
+
+func (c *shopClient) PlaceOrder(ctx context.Context, in *PlaceOrderRequest, opts ...grpc.CallOption) (*Order, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Order)
+	err := c.cc.Invoke(ctx, Shop_PlaceOrder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shopClient) GetOrder(ctx context.Context, in *GetOrderRequest, opts ...grpc.CallOption) (*Order, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Order)
+	err := c.cc.Invoke(ctx, Shop_GetOrder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ShopServer is the server API for Shop service.
+// All implementations must embed UnimplementedShopServer
+// for forward compatibility.
+type ShopServer interface {
+	// Sell sells products right away or not at all, like POST /sell.
+	// Out of stock is RESOURCE_EXHAUSTED, a payment that doesn't cover the total is FAILED_PRECONDITION.
+	Sell(context.Context, *SellRequest) (*SellResponse, error)
+	// GetInventory returns the stock and price of every product the worker has or makes, like GET /api/v2/inventory.
+	GetInventory(context.Context, *GetInventoryRequest) (*GetInventoryResponse, error)
+	// StreamInventory streams the changes of the worker, like GET /events. It starts with a snapshot unless it resumes.
+	StreamInventory(*StreamInventoryRequest, grpc.ServerStreamingServer[InventoryEvent]) error
+	// PlaceOrder places an order, like POST /api/v2/orders. A standing order the worker doesn't make is NOT_FOUND.
+	PlaceOrder(context.Context, *PlaceOrderRequest) (*Order, error)
+	// GetOrder returns an order, for buyers polling a standing order. An order the worker doesn't know is NOT_FOUND.
+	GetOrder(context.Context, *GetOrderRequest) (*Order, error)
+	mustEmbedUnimplementedShopServer()
+}
+
+// UnimplementedShopServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedShopServer struct{}
+
+func (UnimplementedShopServer) Sell(context.Context, *SellRequest) (*SellResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Sell not implemented")
+}
+func (UnimplementedShopServer) GetInventory(context.Context, *GetInventoryRequest) (*GetInventoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetInventory not implemented")
+}
+func (UnimplementedShopServer) StreamInventory(*StreamInventoryRequest, grpc.ServerStreamingServer[InventoryEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamInventory not implemented")
+}
+func (UnimplementedShopServer) PlaceOrder(context.Context, *PlaceOrderRequest) (*Order, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PlaceOrder not implemented")
+}
+func (UnimplementedShopServer) GetOrder(context.Context, *GetOrderRequest) (*Order, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOrder not implemented")
+}
+func (UnimplementedShopServer) mustEmbedUnimplementedShopServer() {}
+func (UnimplementedShopServer) testEmbeddedByValue()              {}
+
+// UnsafeShopServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ShopServer will
+// result in compilation errors.
+type UnsafeShopServer interface {
+	mustEmbedUnimplementedShopServer()
+}
+
+func RegisterShopServer(s grpc.ServiceRegistrar, srv ShopServer) {
+	// If the following call pancis, it indicates UnimplementedShopServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Shop_ServiceDesc, srv)
+}
+
+func _Shop_Sell_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SellRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShopServer).Sell(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shop_Sell_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShopServer).Sell(ctx, req.(*SellRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shop_GetInventory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInventoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShopServer).GetInventory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shop_GetInventory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShopServer).GetInventory(ctx, req.(*GetInventoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shop_StreamInventory_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamInventoryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ShopServer).StreamInventory(m, &grpc.GenericServerStream[StreamInventoryRequest, InventoryEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Shop_StreamInventoryServer = grpc.ServerStreamingServer[InventoryEvent]
+
+func _Shop_PlaceOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PlaceOrderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShopServer).PlaceOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shop_PlaceOrder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShopServer).PlaceOrder(ctx, req.(*PlaceOrderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shop_GetOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOrderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShopServer).GetOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shop_GetOrder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShopServer).GetOrder(ctx, req.(*GetOrderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Shop_ServiceDesc is the grpc.ServiceDesc for Shop service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Shop_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "civ.shop.v1.Shop",
+	HandlerType: (*ShopServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Sell",
+			Handler:    _Shop_Sell_Handler,
+		},
+		{
+			MethodName: "GetInventory",
+			Handler:    _Shop_GetInventory_Handler,
+		},
+		{
+			MethodName: "PlaceOrder",
+			Handler:    _Shop_PlaceOrder_Handler,
+		},
+		{
+			MethodName: "GetOrder",
+			Handler:    _Shop_GetOrder_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamInventory",
+			Handler:       _Shop_StreamInventory_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "internal/apis/shop/v1/shop.proto",
+}
@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	authenticationv1client "k8s.io/client-go/kubernetes/typed/authentication/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// Audience is the audience of the tokens shops send each other, so a token a store receives can't be used against the API server
+const Audience = "civ"
+
+// WorkerServiceAccount is the service account of the shop workers, the only one that buys from shops
+const WorkerServiceAccount = "civ-worker"
+
+const (
+	cacheTTL  = time.Minute      // cacheTTL is how long a reviewed token is trusted before it is reviewed again
+	deniedTTL = 10 * time.Second // deniedTTL is how long a rejected token is rejected without asking the API server
+	cacheSize = 1024             // cacheSize is the most tokens the cache holds before it drops the expired ones
+)
+
+var (
+	// ErrUnauthenticated is returned for requests without a token, or with a token the API server doesn't accept
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrForbidden is returned for callers the policy of the shop doesn't let buy
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Mode is what a shop does with the tokens of its buyers
+type Mode string
+
+const (
+	ModeOff     Mode = "off"     // ModeOff sells to anyone without looking at tokens
+	ModeAudit   Mode = "audit"   // ModeAudit reviews the tokens and logs the callers it would turn away, but sells to them
+	ModeEnforce Mode = "enforce" // ModeEnforce only sells to callers with a valid token the policy allows
+)
+
+// ParseMode parses an auth mode, empty is off
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "", ModeOff:
+		return ModeOff, nil
+	case ModeAudit, ModeEnforce:
+		return Mode(s), nil
+	default:
+		return "", fmt.Errorf("unknown auth mode %q, use off, audit or enforce", s)
+	}
+}
+
+// Identity is who sent a token, as told by the TokenReview
+type Identity struct {
+	Username       string // Username is the full name, such as system:serviceaccount:kingdom-of-foobar:civ-worker
+	Kingdom        string // Kingdom is the namespace of the service account
+	ServiceAccount string
+	Pod            string // Pod is the pod the token is bound to, empty for tokens that aren't bound to a pod
+	Shop           string // Shop is the deployment of the pod, empty when there is no pod
+}
+
+// Principal names the caller for the orders it owns: the pod the token is bound to, or the user for tokens without a pod.
+// It is empty when the token wasn't looked at.
+func (id Identity) Principal() string {
+	if id.Pod != "" {
+		return id.Kingdom + "/" + id.Pod
+	}
+	return id.Username
+}
+
+// Policy decides which shops may buy. Empty lists allow every kingdom and every shop.
+type Policy struct {
+	Kingdoms []string
+	Shops    []string
+}
+
+// Allows returns nil when the caller may buy, an error wrapping ErrForbidden otherwise
+func (p Policy) Allows(id Identity) error {
+	if id.ServiceAccount != WorkerServiceAccount {
+		return fmt.Errorf("%w: %s is not a shop worker", ErrForbidden, id.Username)
+	}
+	if len(p.Kingdoms) > 0 && !slices.Contains(p.Kingdoms, id.Kingdom) {
+		return fmt.Errorf("%w: shops of %s may not buy here", ErrForbidden, id.Kingdom)
+	}
+	if len(p.Shops) > 0 && !slices.Contains(p.Shops, id.Shop) {
+		return fmt.Errorf("%w: %q shops may not buy here", ErrForbidden, id.Shop)
+	}
+	return nil
+}
+
+// Authenticator checks the tokens of the buyers with the TokenReview API and applies the policy of the shop.
+// Reviews are cached by the hash of the token, so a busy buyer doesn't cost a request to the API server per purchase.
+// A nil Authenticator lets everyone buy.
+type Authenticator struct {
+	reviews authenticationv1client.TokenReviewInterface
+	pods    corev1client.PodsGetter
+	mode    Mode
+	policy  Policy
+
+	lock  sync.Mutex
+	cache map[[sha256.Size]byte]review
+	now   func() time.Time
+}
+
+// review is the cached outcome of a TokenReview
+type review struct {
+	identity Identity
+	err      error
+	expires  time.Time
+}
+
+// NewAuthenticator creates an authenticator that reviews tokens and looks up the pods they are bound to through the clients,
+// such as clientset.AuthenticationV1().TokenReviews() and clientset.CoreV1() of a real or a fake clientset
+func NewAuthenticator(reviews authenticationv1client.TokenReviewInterface, pods corev1client.PodsGetter, mode Mode, policy Policy) *Authenticator {
+	return &Authenticator{
+		reviews: reviews,
+		pods:    pods,
+		mode:    mode,
+		policy:  policy,
+		cache:   make(map[[sha256.Size]byte]review),
+		now:     time.Now,
+	}
+}
+
+// Authorize checks the token of a caller against the policy. The error wraps ErrUnauthenticated or ErrForbidden
+// when the caller is turned away, any other error means the token could not be reviewed.
+// In audit mode the caller is logged and let through, and with auth off the token isn't looked at.
+func (a *Authenticator) Authorize(ctx context.Context, token string) (Identity, error) {
+	if a == nil {
+		return Identity{}, nil
+	}
+	return a.authorize(ctx, token, a.policy)
+}
+
+// AuthorizeWorker checks that the token belongs to a shop worker of any kingdom, whatever the policy of the shop,
+// such as a store delivering a standing order. The mode applies like in Authorize.
+func (a *Authenticator) AuthorizeWorker(ctx context.Context, token string) (Identity, error) {
+	if a == nil {
+		return Identity{}, nil
+	}
+	return a.authorize(ctx, token, Policy{})
+}
+
+func (a *Authenticator) authorize(ctx context.Context, token string, policy Policy) (Identity, error) {
+	if a.mode == ModeOff {
+		return Identity{}, nil
+	}
+	id, err := a.Authenticate(ctx, token)
+	if err == nil {
+		err = policy.Allows(id)
+	}
+	if err != nil && a.mode == ModeAudit {
+		slog.WarnContext(ctx, "would turn the caller away", "user", id.Username, "shop", id.Shop, "error", err)
+		return id, nil
+	}
+	return id, err
+}
+
+// Authenticate returns who sent the token, reviewing it unless a recent review is cached
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (Identity, error) {
+	if token == "" {
+		return Identity{}, fmt.Errorf("%w: no bearer token", ErrUnauthenticated)
+	}
+	key := sha256.Sum256([]byte(token))
+	now := a.now()
+	a.lock.Lock()
+	cached, ok := a.cache[key]
+	a.lock.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.identity, cached.err
+	}
+
+	id, err := a.review(ctx, token)
+	if err != nil && !errors.Is(err, ErrUnauthenticated) {
+		// the API server could not be asked, the next call tries again
+		return Identity{}, err
+	}
+	ttl := cacheTTL
+	if err != nil {
+		ttl = deniedTTL
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if len(a.cache) >= cacheSize {
+		for key, cached := range a.cache {
+			if !now.Before(cached.expires) {
+				delete(a.cache, key)
+			}
+		}
+		if len(a.cache) >= cacheSize {
+			clear(a.cache)
+		}
+	}
+	a.cache[key] = review{identity: id, err: err, expires: now.Add(ttl)}
+	return id, err
+}
+
+// review asks the API server who the token belongs to
+func (a *Authenticator) review(ctx context.Context, token string) (Identity, error) {
+	tr, err := a.reviews.Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: []string{Audience},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return Identity{}, fmt.Errorf("token review failed: %w", err)
+	}
+	if !tr.Status.Authenticated {
+		if tr.Status.Error != "" {
+			return Identity{}, fmt.Errorf("%w: %s", ErrUnauthenticated, tr.Status.Error)
+		}
+		return Identity{}, fmt.Errorf("%w: invalid token", ErrUnauthenticated)
+	}
+	// an authenticator that ignores the requested audiences answers with the audiences of the token, which must include civ
+	if !slices.Contains(tr.Status.Audiences, Audience) {
+		return Identity{}, fmt.Errorf("%w: the token is not meant for %s", ErrUnauthenticated, Audience)
+	}
+
+	id := Identity{Username: tr.Status.User.Username}
+	// service accounts are system:serviceaccount:<namespace>:<name>, other users are never shops
+	if rest, ok := strings.CutPrefix(id.Username, "system:serviceaccount:"); ok {
+		id.Kingdom, id.ServiceAccount, _ = strings.Cut(rest, ":")
+	}
+	if pods := tr.Status.User.Extra["authentication.kubernetes.io/pod-name"]; len(pods) > 0 && id.Kingdom != "" {
+		id.Pod = pods[0]
+		var uid string
+		if uids := tr.Status.User.Extra["authentication.kubernetes.io/pod-uid"]; len(uids) > 0 {
+			uid = uids[0]
+		}
+		if id.Shop, err = a.shopOfPod(ctx, id.Kingdom, id.Pod, uid); err != nil {
+			return Identity{}, err
+		}
+	}
+	return id, nil
+}
+
+// shopOfPod returns the shop label of the pod a token is bound to. The pod must still be the one the token was issued for,
+// a token of a deleted pod, or of an older pod with the same name, is rejected.
+func (a *Authenticator) shopOfPod(ctx context.Context, namespace, name, uid string) (string, error) {
+	pod, err := a.pods.Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("%w: the pod %s/%s of the token is gone", ErrUnauthenticated, namespace, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get the pod of the token: %w", err)
+	}
+	if uid != "" && string(pod.UID) != uid {
+		return "", fmt.Errorf("%w: the token is bound to an older pod %s/%s", ErrUnauthenticated, namespace, name)
+	}
+	return pod.Labels[k8s.ShopLabel], nil
+}
+
+// BearerToken returns the token of an Authorization header, empty if there is none
+func BearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
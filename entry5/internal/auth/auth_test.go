@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// tokens are the tokens the fake API server knows, as the pods of the kingdom-of-foobar would send them
+var tokens = map[string]authenticationv1.UserInfo{
+	"craftsman": workerUser("kingdom-of-foobar", "craftsman-0", "uid-craftsman"),
+	"stale":     workerUser("kingdom-of-foobar", "craftsman-0", "uid-older-pod"),
+	"gone":      workerUser("kingdom-of-foobar", "woodworker-0", "uid-woodworker"),
+	"rival":     workerUser("kingdom-of-barfoo", "ironworker-0", "uid-ironworker"),
+	"default":   {Username: "system:serviceaccount:kingdom-of-foobar:default"},
+}
+
+func workerUser(kingdom, pod, uid string) authenticationv1.UserInfo {
+	return authenticationv1.UserInfo{
+		Username: "system:serviceaccount:" + kingdom + ":" + WorkerServiceAccount,
+		Extra: map[string]authenticationv1.ExtraValue{
+			"authentication.kubernetes.io/pod-name": {pod},
+			"authentication.kubernetes.io/pod-uid":  {uid},
+		},
+	}
+}
+
+// newTestAuthenticator returns an authenticator on a fake API server that reviews the tokens above,
+// with the craftsman and ironworker pods running. The token "other-audience" is valid, but not for civ.
+// The count is the number of reviews the API server was asked for.
+func newTestAuthenticator(mode Mode, policy Policy) (*Authenticator, *int) {
+	clientset := fake.NewClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "craftsman-0", Namespace: "kingdom-of-foobar", UID: "uid-craftsman", Labels: map[string]string{k8s.ShopLabel: "craftsman"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "ironworker-0", Namespace: "kingdom-of-barfoo", UID: "uid-ironworker", Labels: map[string]string{k8s.ShopLabel: "ironworker"}}},
+	)
+	count := 0
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		count++
+		tr := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview).DeepCopy()
+		if tr.Spec.Token == "other-audience" {
+			tr.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: tokens["craftsman"], Audiences: []string{"https://kubernetes.default.svc"}}
+		} else if user, ok := tokens[tr.Spec.Token]; ok {
+			tr.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: user, Audiences: tr.Spec.Audiences}
+		} else {
+			tr.Status = authenticationv1.TokenReviewStatus{Error: "invalid bearer token"}
+		}
+		return true, tr, nil
+	})
+	return NewAuthenticator(clientset.AuthenticationV1().TokenReviews(), clientset.CoreV1(), mode, policy), &count
+}
+
+func TestAuthorizeEnforce(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newTestAuthenticator(ModeEnforce, Policy{Kingdoms: []string{"kingdom-of-foobar"}, Shops: []string{"craftsman"}})
+
+	id, err := a.Authorize(ctx, "craftsman")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Kingdom != "kingdom-of-foobar" || id.Shop != "craftsman" || id.Principal() != "kingdom-of-foobar/craftsman-0" {
+		t.Errorf("identity = %+v, want the craftsman-0 pod of kingdom-of-foobar", id)
+	}
+
+	for _, tt := range []struct {
+		token string
+		want  error
+	}{
+		{"", ErrUnauthenticated},
+		{"forged", ErrUnauthenticated},
+		{"other-audience", ErrUnauthenticated},
+		{"stale", ErrUnauthenticated},
+		{"gone", ErrUnauthenticated},
+		{"default", ErrForbidden},
+		{"rival", ErrForbidden},
+	} {
+		if _, err := a.Authorize(ctx, tt.token); !errors.Is(err, tt.want) {
+			t.Errorf("Authorize(%q) = %v, want %v", tt.token, err, tt.want)
+		}
+	}
+	// a store delivering an order only needs to be a shop worker
+	if _, err := a.AuthorizeWorker(ctx, "rival"); err != nil {
+		t.Errorf("AuthorizeWorker(rival) = %v, want it let through", err)
+	}
+	if _, err := a.AuthorizeWorker(ctx, "default"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("AuthorizeWorker(default) = %v, want ErrForbidden", err)
+	}
+}
+
+func TestAuthorizeAudit(t *testing.T) {
+	a, _ := newTestAuthenticator(ModeAudit, Policy{Kingdoms: []string{"kingdom-of-foobar"}})
+
+	for _, token := range []string{"", "forged", "rival"} {
+		if _, err := a.Authorize(context.Background(), token); err != nil {
+			t.Errorf("Authorize(%q) = %v, want audit to let it through", token, err)
+		}
+	}
+	if id, _ := a.Authorize(context.Background(), "rival"); id.Shop != "ironworker" {
+		t.Errorf("identity = %+v, want the caller still told apart", id)
+	}
+}
+
+func TestAuthorizeOff(t *testing.T) {
+	a, count := newTestAuthenticator(ModeOff, Policy{Kingdoms: []string{"kingdom-of-foobar"}})
+
+	if id, err := a.Authorize(context.Background(), "forged"); err != nil || id != (Identity{}) {
+		t.Errorf("Authorize = %+v, %v, want no identity and no error", id, err)
+	}
+	if *count != 0 {
+		t.Errorf("%d tokens reviewed, want none with auth off", *count)
+	}
+	var nilAuthenticator *Authenticator
+	if _, err := nilAuthenticator.Authorize(context.Background(), "forged"); err != nil {
+		t.Errorf("nil authenticator = %v, want everyone let through", err)
+	}
+}
+
+func TestPolicyAllows(t *testing.T) {
+	worker := Identity{Username: "system:serviceaccount:kingdom-of-foobar:civ-worker", Kingdom: "kingdom-of-foobar", ServiceAccount: WorkerServiceAccount, Shop: "craftsman"}
+	for _, tt := range []struct {
+		name   string
+		policy Policy
+		id     Identity
+		want   error
+	}{
+		{"empty policy", Policy{}, worker, nil},
+		{"allowed kingdom and shop", Policy{Kingdoms: []string{"kingdom-of-foobar"}, Shops: []string{"craftsman"}}, worker, nil},
+		{"other kingdom", Policy{Kingdoms: []string{"kingdom-of-barfoo"}}, worker, ErrForbidden},
+		{"other shop", Policy{Shops: []string{"woodworker"}}, worker, ErrForbidden},
+		{"not a worker", Policy{}, Identity{Username: "system:serviceaccount:kingdom-of-foobar:default", Kingdom: "kingdom-of-foobar", ServiceAccount: "default"}, ErrForbidden},
+		{"not a service account", Policy{}, Identity{Username: "admin"}, ErrForbidden},
+	} {
+		if err := tt.policy.Allows(tt.id); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Allows = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestAuthenticateCache(t *testing.T) {
+	ctx := context.Background()
+	a, count := newTestAuthenticator(ModeEnforce, Policy{})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	for range 3 {
+		if _, err := a.Authenticate(ctx, "craftsman"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.Authenticate(ctx, "forged"); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("Authenticate(forged) = %v, want ErrUnauthenticated", err)
+		}
+	}
+	if *count != 2 {
+		t.Errorf("%d reviews, want one per token while cached", *count)
+	}
+
+	// the rejection expires first, the valid token is still trusted
+	now = now.Add(deniedTTL)
+	a.Authenticate(ctx, "craftsman")
+	a.Authenticate(ctx, "forged")
+	if *count != 3 {
+		t.Errorf("%d reviews after %s, want the rejected token reviewed again", *count, deniedTTL)
+	}
+
+	now = now.Add(cacheTTL)
+	a.Authenticate(ctx, "craftsman")
+	if *count != 4 {
+		t.Errorf("%d reviews after %s, want the valid token reviewed again", *count, cacheTTL)
+	}
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTokenFile is where the chart projects the service account token with the civ audience
+const DefaultTokenFile = "/var/run/secrets/civ/token"
+
+// tokenRefresh is how often the token file is read again, the kubelet replaces the token long before it expires
+const tokenRefresh = time.Minute
+
+// TokenFile is the projected service account token a worker sends to the stores it buys from
+type TokenFile struct {
+	path string
+
+	lock   sync.Mutex
+	token  string
+	read   time.Time
+	failed bool // failed keeps a missing file from being logged on every purchase
+}
+
+// NewTokenFile reads the token from the file, such as DefaultTokenFile
+func NewTokenFile(path string) *TokenFile {
+	return &TokenFile{path: path}
+}
+
+// Token returns the current token, empty when the file can't be read. A nil TokenFile has no token.
+func (t *TokenFile) Token() string {
+	if t == nil {
+		return ""
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.token != "" && time.Since(t.read) < tokenRefresh {
+		return t.token
+	}
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		if !t.failed {
+			slog.Warn("failed to read the service account token, buying without it", "path", t.path, "error", err)
+			t.failed = true
+		}
+		return t.token
+	}
+	t.token, t.read, t.failed = strings.TrimSpace(string(data)), time.Now(), false
+	return t.token
+}
+
+// GetRequestMetadata sends the token with every gRPC call, as credentials.PerRPCCredentials
+func (t *TokenFile) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token := t.Token()
+	if token == "" {
+		return nil, nil
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// RequireTransportSecurity lets the token go over the plaintext connections between shops, like the REST API
+func (t *TokenFile) RequireTransportSecurity() bool {
+	return false
+}
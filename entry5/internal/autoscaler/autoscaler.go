@@ -0,0 +1,243 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
+	"github.com/Potokar1/k8s-research/entry5/internal/town"
+)
+
+// Options configures the autoscaler
+type Options struct {
+	Kingdom string // Kingdom is the namespace of the shops
+	Town    string // Town limits scaling to the shops of one town, empty scales every town
+
+	Interval          time.Duration // Interval is how often the shops are sampled
+	MinReplicas       int32         // MinReplicas is the fewest workers a shop is scaled down to
+	MaxReplicas       int32         // MaxReplicas is the most workers a shop is scaled up to
+	ScaleUpCooldown   time.Duration // ScaleUpCooldown is the time after scaling a shop before it scales up again
+	ScaleDownCooldown time.Duration // ScaleDownCooldown is the time after scaling a shop before it scales down again
+
+	// StarvedRate is the units per minute a shop turns away for lack of stock above which it scales up
+	StarvedRate float64
+	// Surplus scales a shop down when the stock of every product is above Surplus times the minimum for each worker
+	Surplus float64
+
+	DryRun bool // DryRun logs the decisions without scaling
+}
+
+// Decision is the new replicas of a shop
+type Decision struct {
+	Shop   string
+	From   int32
+	To     int32
+	Reason string
+}
+
+// Autoscaler scales the Deployment of each shop from the stock and the rejected sales its workers publish.
+// It scales a shop up when its buyers get 409 Conflict responses, and down when its stock piles up.
+type Autoscaler struct {
+	client *k8s.Client
+	opts   Options
+
+	rejected   map[string]map[string]int // rejected are the counters of each pod at the last sample
+	sampled    time.Time                 // sampled is the time of the last sample
+	lastScaled map[string]time.Time      // lastScaled is the last time each shop was scaled
+}
+
+// New creates an autoscaler, filling in defaults for the unset options
+func New(client *k8s.Client, opts Options) *Autoscaler {
+	if opts.Interval == 0 {
+		opts.Interval = 15 * time.Second
+	}
+	if opts.MinReplicas == 0 {
+		opts.MinReplicas = 1
+	}
+	if opts.MaxReplicas == 0 {
+		opts.MaxReplicas = 10
+	}
+	if opts.ScaleUpCooldown == 0 {
+		opts.ScaleUpCooldown = time.Minute
+	}
+	if opts.ScaleDownCooldown == 0 {
+		opts.ScaleDownCooldown = 5 * time.Minute
+	}
+	if opts.StarvedRate == 0 {
+		opts.StarvedRate = 1
+	}
+	if opts.Surplus == 0 {
+		opts.Surplus = 3
+	}
+	return &Autoscaler{
+		client:     client,
+		opts:       opts,
+		rejected:   make(map[string]map[string]int),
+		lastScaled: make(map[string]time.Time),
+	}
+}
+
+// Run samples the shops every interval until the context is canceled.
+// Errors are logged and retried on the next interval.
+func (a *Autoscaler) Run(ctx context.Context) error {
+	if a.opts.MinReplicas > a.opts.MaxReplicas {
+		return fmt.Errorf("min replicas %d is above max replicas %d", a.opts.MinReplicas, a.opts.MaxReplicas)
+	}
+
+	tick := time.NewTicker(a.opts.Interval)
+	defer tick.Stop()
+	for {
+		if _, err := a.Step(ctx, time.Now()); err != nil {
+			slog.ErrorContext(ctx, "error autoscaling shops", "error", err)
+		}
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// shopSample is the state of every worker of a shop at one sample
+type shopSample struct {
+	replicas int32
+	stock    map[string]int // stock is the inventory of the shop's products summed over its workers
+	minimum  map[string]int // minimum is the minimum of each of the shop's products for a single worker
+	rejected int            // rejected are the units turned away since the last sample
+}
+
+// Step samples the shops once and scales the ones that need it
+func (a *Autoscaler) Step(ctx context.Context, now time.Time) ([]Decision, error) {
+	shops, err := town.LoadFromCluster(ctx, a.client, a.opts.Kingdom, a.opts.Town)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := a.client.ListShopPods(ctx, a.opts.Kingdom, a.opts.Town)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make(map[string]*shopSample, len(shops))
+	for _, shop := range shops {
+		s := &shopSample{
+			replicas: int32(shop.Replicas),
+			stock:    make(map[string]int),
+			minimum:  make(map[string]int),
+		}
+		for _, direction := range shop.Directions {
+			s.stock[direction.Product] = 0
+			s.minimum[direction.Product] = direction.Minimum
+		}
+		samples[shop.Type] = s
+	}
+	seen := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		s, ok := samples[pod.Labels[k8s.ShopLabel]]
+		if !ok || pod.DeletionTimestamp != nil {
+			continue
+		}
+		seen[pod.Name] = true
+		doc, err := k8s.DecodeInventoryAnnotation(pod.Annotations)
+		if err != nil {
+			slog.DebugContext(ctx, "skipping bad inventory annotation", "pod", pod.Name, "error", err)
+			continue
+		}
+		var rejected map[string]int
+		if doc != nil {
+			for product := range s.stock {
+				s.stock[product] += doc.Inventory[product]
+			}
+			rejected = doc.Rejected
+		}
+		previous, known := a.rejected[pod.Name]
+		for product, count := range rejected {
+			if !known && a.sampled.IsZero() {
+				continue // the first sample only sets the baseline, a pod that shows up later counts from zero
+			}
+			if count >= previous[product] {
+				s.rejected += count - previous[product]
+			} else {
+				s.rejected += count // the worker restarted and its counters started over
+			}
+		}
+		a.rejected[pod.Name] = rejected
+	}
+	for pod := range a.rejected {
+		if !seen[pod] {
+			delete(a.rejected, pod)
+		}
+	}
+
+	var elapsed time.Duration
+	if !a.sampled.IsZero() {
+		elapsed = now.Sub(a.sampled)
+	}
+	a.sampled = now
+
+	var decisions []Decision
+	for _, shop := range shops {
+		decision, ok := a.decide(shop.Type, samples[shop.Type], elapsed, now)
+		if !ok {
+			continue
+		}
+		slog.InfoContext(ctx, "scaling shop", "shop", decision.Shop, "from", decision.From, "to", decision.To, "reason", decision.Reason, "dry_run", a.opts.DryRun)
+		if !a.opts.DryRun {
+			if err := a.client.ScaleDeployment(ctx, a.opts.Kingdom, decision.Shop, decision.To); err != nil {
+				slog.ErrorContext(ctx, "error scaling shop", "shop", decision.Shop, "error", err)
+				continue
+			}
+		}
+		a.lastScaled[decision.Shop] = now
+		decisions = append(decisions, decision)
+	}
+	return decisions, nil
+}
+
+// decide returns the new replicas of a shop, or false if the shop should stay as it is
+func (a *Autoscaler) decide(shop string, s *shopSample, elapsed time.Duration, now time.Time) (Decision, bool) {
+	decision := Decision{Shop: shop, From: s.replicas}
+
+	// bounds apply right away, cooldowns don't hold them back
+	switch {
+	case s.replicas < a.opts.MinReplicas:
+		decision.To, decision.Reason = a.opts.MinReplicas, "below min replicas"
+		return decision, true
+	case s.replicas > a.opts.MaxReplicas:
+		decision.To, decision.Reason = a.opts.MaxReplicas, "above max replicas"
+		return decision, true
+	}
+
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(s.rejected) / elapsed.Minutes()
+	}
+	sinceScaled := now.Sub(a.lastScaled[shop])
+
+	if rate > a.opts.StarvedRate {
+		if s.replicas >= a.opts.MaxReplicas || sinceScaled < a.opts.ScaleUpCooldown {
+			return decision, false
+		}
+		decision.To = s.replicas + 1
+		decision.Reason = fmt.Sprintf("buyers starved, %.1f units rejected per minute", rate)
+		return decision, true
+	}
+
+	if s.rejected > 0 || len(s.stock) == 0 {
+		return decision, false
+	}
+	for product, stock := range s.stock {
+		// a product without a minimum counts as a minimum of one
+		floor := float64(max(s.minimum[product], 1)) * float64(s.replicas)
+		if float64(stock) < a.opts.Surplus*floor {
+			return decision, false
+		}
+	}
+	if s.replicas <= a.opts.MinReplicas || sinceScaled < a.opts.ScaleDownCooldown {
+		return decision, false
+	}
+	decision.To = s.replicas - 1
+	decision.Reason = "stock piling up"
+	return decision, true
+}
@@ -0,0 +1,66 @@
+package clock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits. Workers produce, rest and price on a clock,
+// so a town can run on the wall clock, faster than it, or on virtual time in a simulation.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// Go runs the function on its own goroutine and adds it to the wait group.
+// A virtual clock keeps track of the goroutine, any other clock doesn't need to.
+func Go(c Clock, wg *sync.WaitGroup, f func()) {
+	if v, ok := c.(*Virtual); ok {
+		v.Go(wg, f)
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		f()
+	}()
+}
+
+// Real is the wall clock
+type Real struct{}
+
+func (Real) Now() time.Time                         { return time.Now() }
+func (Real) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Scaled is the wall clock sped up by a factor: at a speed of 10, a 10s interval passes in 1s
+// and the time it tells moves 10 times as fast from when the clock was created.
+type Scaled struct {
+	speed float64
+	start time.Time
+}
+
+// NewScaled returns a clock running at the speed, the wall clock itself at a speed of 1
+func NewScaled(speed float64) (Clock, error) {
+	if speed <= 0 {
+		return nil, fmt.Errorf("speed must be positive, got %v", speed)
+	}
+	if speed == 1 {
+		return Real{}, nil
+	}
+	return &Scaled{speed: speed, start: time.Now()}, nil
+}
+
+func (c *Scaled) Now() time.Time {
+	return c.start.Add(c.scale(time.Since(c.start)))
+}
+
+func (c *Scaled) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	time.AfterFunc(time.Duration(float64(d)/c.speed), func() { ch <- c.Now() })
+	return ch
+}
+
+func (c *Scaled) scale(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * c.speed)
+}
@@ -0,0 +1,115 @@
+package clock
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Virtual is a clock that only moves when its owner moves it, to run a simulation or a test without waiting.
+// Every goroutine it starts is either running or waiting on the clock. Time only moves when all of them wait,
+// and the waiters are woken one at a time in deadline order, so the workers never run at the same time
+// and a simulation gives the same result on every run.
+type Virtual struct {
+	lock    sync.Mutex
+	idle    *sync.Cond // idle is signaled when a goroutine starts waiting or exits
+	now     time.Time
+	running int // running is the number of goroutines that are not waiting on the clock
+	waiters []*waiter
+	seq     int // seq orders waiters with the same deadline by when they started waiting
+}
+
+type waiter struct {
+	deadline time.Time
+	seq      int
+	ch       chan time.Time
+}
+
+// NewVirtual returns a virtual clock that starts at the time
+func NewVirtual(start time.Time) *Virtual {
+	c := &Virtual{now: start}
+	c.idle = sync.NewCond(&c.lock)
+	return c
+}
+
+func (c *Virtual) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the time once the clock reaches the deadline.
+// The calling goroutine counts as waiting from now on.
+func (c *Virtual) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	w := &waiter{
+		deadline: c.now.Add(d),
+		seq:      c.seq,
+		ch:       make(chan time.Time, 1),
+	}
+	c.seq++
+	c.waiters = append(c.waiters, w)
+	c.running--
+	c.idle.Broadcast()
+	return w.ch
+}
+
+// Go runs the function on its own goroutine, which counts as running until it waits on the clock
+func (c *Virtual) Go(wg *sync.WaitGroup, f func()) {
+	c.lock.Lock()
+	c.running++
+	c.lock.Unlock()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		f()
+		c.lock.Lock()
+		c.running--
+		c.idle.Broadcast()
+		c.lock.Unlock()
+	}()
+}
+
+// Next waits until every goroutine waits on the clock, and returns the earliest deadline.
+// It returns false when nothing waits on the clock.
+func (c *Virtual) Next() (time.Time, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for c.running > 0 {
+		c.idle.Wait()
+	}
+	if len(c.waiters) == 0 {
+		return time.Time{}, false
+	}
+	slices.SortFunc(c.waiters, func(a, b *waiter) int {
+		if cmp := a.deadline.Compare(b.deadline); cmp != 0 {
+			return cmp
+		}
+		return a.seq - b.seq
+	})
+	return c.waiters[0].deadline, true
+}
+
+// Wake moves the clock to the earliest deadline and wakes its waiter. It must follow a call to Next.
+func (c *Virtual) Wake() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	w := c.waiters[0]
+	c.waiters = c.waiters[1:]
+	if w.deadline.After(c.now) {
+		c.now = w.deadline
+	}
+	c.running++
+	w.ch <- c.now
+}
+
+// Set moves the clock forward without waking anyone, such as to look at the state between two deadlines
+func (c *Virtual) Set(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if now.After(c.now) {
+		c.now = now
+	}
+}
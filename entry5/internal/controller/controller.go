@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	civv1alpha1 "github.com/Potokar1/k8s-research/entry5/internal/apis/civ/v1alpha1"
+	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	metav1ac "k8s.io/client-go/applyconfigurations/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// DefaultWorkerImage is the image built by skaffold for the worker pods
+const DefaultWorkerImage = "ghcr.io/potokar1/k8s-research/entry5/worker"
+
+// fieldManager is the name the controller uses when it writes objects
+const fieldManager = "civ-controller"
+
+// Kinds of custom resources the controller reconciles
+const (
+	KindKingdom = "Kingdom"
+	KindTown    = "Town"
+	KindShop    = "Shop"
+)
+
+// request is a single item of work in the queue
+type request struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (r request) String() string {
+	if r.Namespace == "" {
+		return r.Kind + "/" + r.Name
+	}
+	return r.Kind + "/" + r.Namespace + "/" + r.Name
+}
+
+// Options configures the controller
+type Options struct {
+	WorkerImage  string        // WorkerImage is the default image used for shop workers
+	Resync       time.Duration // Resync is how often every object is reconciled even without changes
+	OTLPEndpoint string        // OTLPEndpoint is the collector workers send traces to, empty disables tracing
+	WorkerAuth   string        // WorkerAuth is what the workers do with the tokens of their buyers: off, audit or enforce
+}
+
+// Controller reconciles Kingdom, Town and Shop resources into the
+// Namespace, RBAC, ConfigMap, Deployment and Service objects a kingdom needs.
+type Controller struct {
+	kube    kubernetes.Interface
+	dynamic dynamic.Interface
+	opts    Options
+
+	dynamicFactory dynamicinformer.DynamicSharedInformerFactory
+	kubeFactory    informers.SharedInformerFactory
+
+	kingdoms    cache.SharedIndexInformer
+	towns       cache.SharedIndexInformer
+	shops       cache.SharedIndexInformer
+	deployments cache.SharedIndexInformer
+
+	queue workqueue.TypedRateLimitingInterface[request]
+}
+
+// NewController creates a controller from a kubernetes and a dynamic client.
+// Both can be real clients or the fakes from client-go.
+func NewController(kube kubernetes.Interface, dyn dynamic.Interface, opts Options) *Controller {
+	if opts.WorkerImage == "" {
+		opts.WorkerImage = DefaultWorkerImage
+	}
+	if opts.Resync == 0 {
+		opts.Resync = 30 * time.Second
+	}
+	if opts.WorkerAuth == "" {
+		opts.WorkerAuth = "off"
+	}
+
+	c := &Controller{
+		kube:           kube,
+		dynamic:        dyn,
+		opts:           opts,
+		dynamicFactory: dynamicinformer.NewDynamicSharedInformerFactory(dyn, opts.Resync),
+		kubeFactory: informers.NewSharedInformerFactoryWithOptions(kube, opts.Resync,
+			informers.WithTweakListOptions(func(lo *metav1.ListOptions) {
+				lo.LabelSelector = k8s.ShopLabel // only deployments that belong to a shop
+			})),
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.DefaultTypedControllerRateLimiter[request](),
+			workqueue.TypedRateLimitingQueueConfig[request]{Name: "civ"},
+		),
+	}
+
+	c.kingdoms = c.dynamicFactory.ForResource(civv1alpha1.KingdomResource).Informer()
+	c.towns = c.dynamicFactory.ForResource(civv1alpha1.TownResource).Informer()
+	c.shops = c.dynamicFactory.ForResource(civv1alpha1.ShopResource).Informer()
+	c.deployments = c.kubeFactory.Apps().V1().Deployments().Informer()
+
+	c.kingdoms.AddEventHandler(c.enqueueHandler(c.enqueueKingdom))
+	c.towns.AddEventHandler(c.enqueueHandler(c.enqueueTown))
+	c.shops.AddEventHandler(c.enqueueHandler(c.enqueueShop))
+	c.deployments.AddEventHandler(c.enqueueHandler(c.enqueueDeploymentOwner))
+
+	return c
+}
+
+// Run starts the informers and the given number of reconcile workers.
+// Run blocks until the context is canceled.
+func (c *Controller) Run(ctx context.Context, workers int) error {
+	defer c.queue.ShutDown()
+
+	c.dynamicFactory.Start(ctx.Done())
+	c.kubeFactory.Start(ctx.Done())
+
+	slog.InfoContext(ctx, "waiting for informer caches to sync")
+	if !cache.WaitForCacheSync(ctx.Done(), c.kingdoms.HasSynced, c.towns.HasSynced, c.shops.HasSynced, c.deployments.HasSynced) {
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
+
+	slog.InfoContext(ctx, "starting reconcile workers", "count", workers)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c.processNextItem(ctx) {
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	c.queue.ShutDown()
+	wg.Wait()
+	return nil
+}
+
+// processNextItem reconciles one item from the queue, returning false when the queue is shut down
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	req, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(req)
+
+	if err := c.Reconcile(ctx, req.Kind, req.Namespace, req.Name); err != nil {
+		slog.WarnContext(ctx, "reconcile failed, requeueing", "request", req.String(), "error", err)
+		c.queue.AddRateLimited(req)
+		return true
+	}
+	c.queue.Forget(req)
+	return true
+}
+
+// Reconcile brings the objects owned by a single custom resource to their desired state
+func (c *Controller) Reconcile(ctx context.Context, kind, namespace, name string) error {
+	switch kind {
+	case KindKingdom:
+		return c.reconcileKingdom(ctx, name)
+	case KindTown:
+		return c.reconcileTown(ctx, namespace, name)
+	case KindShop:
+		return c.reconcileShop(ctx, namespace, name)
+	default:
+		return fmt.Errorf("unknown kind %q", kind)
+	}
+}
+
+func (c *Controller) enqueueHandler(enqueue func(obj any)) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueue,
+		UpdateFunc: func(_, newObj any) { enqueue(newObj) },
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			enqueue(obj)
+		},
+	}
+}
+
+func (c *Controller) enqueueKingdom(obj any) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	c.queue.Add(request{Kind: KindKingdom, Name: u.GetName()})
+}
+
+func (c *Controller) enqueueTown(obj any) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	c.queue.Add(request{Kind: KindTown, Namespace: u.GetNamespace(), Name: u.GetName()})
+	// the kingdom lists its towns in its status
+	c.queue.Add(request{Kind: KindKingdom, Name: u.GetNamespace()})
+}
+
+func (c *Controller) enqueueShop(obj any) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	c.queue.Add(request{Kind: KindShop, Namespace: u.GetNamespace(), Name: u.GetName()})
+
+	// the town lists its shops in its status
+	town, _, _ := unstructured.NestedString(u.Object, "spec", "town")
+	if town != "" {
+		c.queue.Add(request{Kind: KindTown, Namespace: u.GetNamespace(), Name: town})
+	}
+}
+
+// enqueueDeploymentOwner enqueues the shop that owns a deployment so its status follows the deployment
+func (c *Controller) enqueueDeploymentOwner(obj any) {
+	deployment, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		return
+	}
+	owner := metav1.GetControllerOf(deployment)
+	if owner == nil || owner.Kind != KindShop || owner.APIVersion != civv1alpha1.GroupVersion.String() {
+		return
+	}
+	c.queue.Add(request{Kind: KindShop, Namespace: deployment.Namespace, Name: owner.Name})
+}
+
+// get returns a typed custom resource from the informer cache, or nil if it does not exist
+func get[T any](informer cache.SharedIndexInformer, namespace, name string) (*T, error) {
+	key := name
+	if namespace != "" {
+		key = namespace + "/" + name
+	}
+	obj, exists, err := informer.GetIndexer().GetByKey(key)
+	if err != nil || !exists {
+		return nil, err
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T", obj)
+	}
+	var typed T
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &typed); err != nil {
+		return nil, err
+	}
+	return &typed, nil
+}
+
+// updateStatus writes the status subresource of a custom resource
+func (c *Controller) updateStatus(ctx context.Context, gvr schema.GroupVersionResource, namespace string, obj any) error {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	_, err = c.dynamic.Resource(gvr).Namespace(namespace).UpdateStatus(ctx, u, metav1.UpdateOptions{FieldManager: fieldManager})
+	return err
+}
+
+// ownerReference makes the given custom resource the controller of another object
+func ownerReference(kind string, meta metav1.ObjectMeta) *metav1ac.OwnerReferenceApplyConfiguration {
+	return metav1ac.OwnerReference().
+		WithAPIVersion(civv1alpha1.GroupVersion.String()).
+		WithKind(kind).
+		WithName(meta.Name).
+		WithUID(meta.UID).
+		WithController(true).
+		WithBlockOwnerDeletion(true)
+}
+
+// applyOptions are used for every server side apply the controller makes
+var applyOptions = metav1.ApplyOptions{FieldManager: fieldManager, Force: true}
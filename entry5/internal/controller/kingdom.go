@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"slices"
+
+	civv1alpha1 "github.com/Potokar1/k8s-research/entry5/internal/apis/civ/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	rbacv1ac "k8s.io/client-go/applyconfigurations/rbac/v1"
+)
+
+// WorkerServiceAccount is the service account the shop workers run as
+const WorkerServiceAccount = "civ-worker"
+
+// reconcileKingdom creates the namespace of the kingdom and the RBAC the workers need to patch themselves and review tokens
+func (c *Controller) reconcileKingdom(ctx context.Context, name string) error {
+	kingdom, err := get[civv1alpha1.Kingdom](c.kingdoms, "", name)
+	if err != nil || kingdom == nil {
+		// deleted kingdoms are cleaned up by the garbage collector through owner references
+		return err
+	}
+	owner := ownerReference(KindKingdom, kingdom.ObjectMeta)
+
+	// Namespace
+	ns := corev1ac.Namespace(name).WithOwnerReferences(owner)
+	if _, err := c.kube.CoreV1().Namespaces().Apply(ctx, ns, applyOptions); err != nil {
+		return err
+	}
+
+	// ServiceAccount for the workers
+	sa := corev1ac.ServiceAccount(WorkerServiceAccount, name).WithOwnerReferences(owner)
+	if _, err := c.kube.CoreV1().ServiceAccounts(name).Apply(ctx, sa, applyOptions); err != nil {
+		return err
+	}
+
+	// Role that lets the workers patch their own pods
+	role := rbacv1ac.Role("pod-patcher", name).
+		WithOwnerReferences(owner).
+		WithRules(
+			rbacv1ac.PolicyRule().
+				WithAPIGroups("").
+				WithResources("pods").
+				WithVerbs("get", "patch"),
+			rbacv1ac.PolicyRule().
+				WithAPIGroups("").
+				WithResources("configmaps").
+				WithVerbs("get", "list", "create", "update"),
+			rbacv1ac.PolicyRule().
+				WithAPIGroups("").
+				WithResources("events").
+				WithVerbs("create", "patch"),
+		)
+	if _, err := c.kube.RbacV1().Roles(name).Apply(ctx, role, applyOptions); err != nil {
+		return err
+	}
+
+	binding := rbacv1ac.RoleBinding("pod-patcher-binding", name).
+		WithOwnerReferences(owner).
+		WithRoleRef(rbacv1ac.RoleRef().
+			WithAPIGroup("rbac.authorization.k8s.io").
+			WithKind("Role").
+			WithName("pod-patcher")).
+		WithSubjects(rbacv1ac.Subject().
+			WithKind("ServiceAccount").
+			WithName(WorkerServiceAccount).
+			WithNamespace(name))
+	if _, err := c.kube.RbacV1().RoleBindings(name).Apply(ctx, binding, applyOptions); err != nil {
+		return err
+	}
+
+	// ClusterRole that lets the workers review the tokens of their buyers and look up the pods of the buyers, in any kingdom
+	clusterRole := rbacv1ac.ClusterRole(WorkerServiceAccount+"-"+name).
+		WithOwnerReferences(owner).
+		WithRules(
+			rbacv1ac.PolicyRule().
+				WithAPIGroups("authentication.k8s.io").
+				WithResources("tokenreviews").
+				WithVerbs("create"),
+			rbacv1ac.PolicyRule().
+				WithAPIGroups("").
+				WithResources("pods").
+				WithVerbs("get"),
+		)
+	if _, err := c.kube.RbacV1().ClusterRoles().Apply(ctx, clusterRole, applyOptions); err != nil {
+		return err
+	}
+
+	clusterBinding := rbacv1ac.ClusterRoleBinding(WorkerServiceAccount + "-" + name).
+		WithOwnerReferences(owner).
+		WithRoleRef(rbacv1ac.RoleRef().
+			WithAPIGroup("rbac.authorization.k8s.io").
+			WithKind("ClusterRole").
+			WithName(WorkerServiceAccount + "-" + name)).
+		WithSubjects(rbacv1ac.Subject().
+			WithKind("ServiceAccount").
+			WithName(WorkerServiceAccount).
+			WithNamespace(name))
+	if _, err := c.kube.RbacV1().ClusterRoleBindings().Apply(ctx, clusterBinding, applyOptions); err != nil {
+		return err
+	}
+
+	// Status: the towns found in the kingdom
+	var towns []string
+	for _, obj := range c.towns.GetStore().List() {
+		if u, ok := obj.(*unstructured.Unstructured); ok && u.GetNamespace() == name {
+			towns = append(towns, u.GetName())
+		}
+	}
+	slices.Sort(towns)
+	if slices.Equal(towns, kingdom.Status.Towns) {
+		return nil
+	}
+	kingdom.Status.Towns = towns
+	return c.updateStatus(ctx, civv1alpha1.KingdomResource, "", kingdom)
+}
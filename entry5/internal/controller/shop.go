@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	civv1alpha1 "github.com/Potokar1/k8s-research/entry5/internal/apis/civ/v1alpha1"
+	"github.com/Potokar1/k8s-research/entry5/internal/auth"
+	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	metav1ac "k8s.io/client-go/applyconfigurations/meta/v1"
+)
+
+// reconcileShop creates the directions ConfigMap, the worker Deployment and the Service of a shop
+func (c *Controller) reconcileShop(ctx context.Context, namespace, name string) error {
+	shop, err := get[civv1alpha1.Shop](c.shops, namespace, name)
+	if err != nil || shop == nil {
+		return err
+	}
+	owner := ownerReference(KindShop, shop.ObjectMeta)
+	labels := map[string]string{
+		k8s.TownLabel: shop.Spec.Town,
+		k8s.ShopLabel: name,
+	}
+
+	// ConfigMap with the directions of the workers. Invalid directions would crash the workers,
+	// so they are reported in the status and the workers keep the last valid ones.
+	directions := shop.Spec.Directions
+	if directions == nil {
+		directions = []civv1alpha1.Direction{}
+	}
+	directionsJSON, err := json.Marshal(directions)
+	if err != nil {
+		return err
+	}
+	if err := validateDirections(directionsJSON); err != nil {
+		status := shop.Status
+		status.Conditions = slices.Clone(shop.Status.Conditions)
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               civv1alpha1.ShopConditionDirectionsValid,
+			Status:             metav1.ConditionFalse,
+			Reason:             "InvalidDirections",
+			Message:            err.Error(),
+			ObservedGeneration: shop.Generation,
+		})
+		return c.updateShopStatus(ctx, shop, status)
+	}
+	configMap := corev1ac.ConfigMap(name+"-directions", namespace).
+		WithLabels(labels).
+		WithOwnerReferences(owner).
+		WithData(map[string]string{"directions.json": string(directionsJSON)})
+	if _, err := c.kube.CoreV1().ConfigMaps(namespace).Apply(ctx, configMap, applyOptions); err != nil {
+		return err
+	}
+
+	// Deployment of the workers
+	if _, err := c.kube.AppsV1().Deployments(namespace).Apply(ctx, c.shopDeployment(shop, labels, owner), applyOptions); err != nil {
+		return err
+	}
+
+	// Service other shops buy from
+	service := corev1ac.Service(name, namespace).
+		WithLabels(labels).
+		WithOwnerReferences(owner).
+		WithSpec(corev1ac.ServiceSpec().
+			WithSelector(labels).
+			WithType(corev1.ServiceTypeClusterIP).
+			WithPorts(corev1ac.ServicePort().
+				WithName("http").
+				WithProtocol(corev1.ProtocolTCP).
+				WithPort(80).
+				WithTargetPort(intstr.FromInt32(8080)),
+				corev1ac.ServicePort().
+					WithName("grpc").
+					WithProtocol(corev1.ProtocolTCP).
+					WithPort(9090).
+					WithTargetPort(intstr.FromInt32(9090))))
+	if _, err := c.kube.CoreV1().Services(namespace).Apply(ctx, service, applyOptions); err != nil {
+		return err
+	}
+
+	// Status: follow the replicas of the deployment
+	status := shop.Status
+	status.Conditions = slices.Clone(shop.Status.Conditions)
+	status.Replicas, status.ReadyReplicas = 0, 0
+	if obj, exists, err := c.deployments.GetIndexer().GetByKey(namespace + "/" + name); err == nil && exists {
+		if deployment, ok := obj.(*appsv1.Deployment); ok {
+			status.Replicas = deployment.Status.Replicas
+			status.ReadyReplicas = deployment.Status.ReadyReplicas
+		}
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               civv1alpha1.ShopConditionDirectionsValid,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Valid",
+		Message:            "the directions are rolled out",
+		ObservedGeneration: shop.Generation,
+	})
+	return c.updateShopStatus(ctx, shop, status)
+}
+
+// validateDirections runs the validation of the workers on the directions of a shop
+func validateDirections(directionsJSON []byte) error {
+	var directions []worker.Direction
+	if err := json.Unmarshal(directionsJSON, &directions); err != nil {
+		return err
+	}
+	return worker.ValidateDirections(directions)
+}
+
+// updateShopStatus writes the status of the shop when it changed
+func (c *Controller) updateShopStatus(ctx context.Context, shop *civv1alpha1.Shop, status civv1alpha1.ShopStatus) error {
+	if equality.Semantic.DeepEqual(status, shop.Status) {
+		return nil
+	}
+	shop.Status = status
+	return c.updateStatus(ctx, civv1alpha1.ShopResource, shop.Namespace, shop)
+}
+
+// shopDeployment builds the deployment of a shop, matching the one rendered by the helm chart
+func (c *Controller) shopDeployment(shop *civv1alpha1.Shop, labels map[string]string, owner *metav1ac.OwnerReferenceApplyConfiguration) *appsv1ac.DeploymentApplyConfiguration {
+	image := shop.Spec.Image
+	if image == "" {
+		image = c.opts.WorkerImage
+	}
+	inventoryStore := shop.Spec.InventoryStore
+	if inventoryStore == "" {
+		inventoryStore = "configmap"
+	}
+	coins := 1000
+	if shop.Spec.Coins != nil {
+		coins = *shop.Spec.Coins
+	}
+	env := []*corev1ac.EnvVarApplyConfiguration{
+		corev1ac.EnvVar().
+			WithName("POD_NAME").
+			WithValueFrom(corev1ac.EnvVarSource().
+				WithFieldRef(corev1ac.ObjectFieldSelector().WithFieldPath("metadata.name"))),
+		corev1ac.EnvVar().
+			WithName("POD_NAMESPACE").
+			WithValue(shop.Namespace),
+		corev1ac.EnvVar().
+			WithName("POD_IP").
+			WithValueFrom(corev1ac.EnvVarSource().
+				WithFieldRef(corev1ac.ObjectFieldSelector().WithFieldPath("status.podIP"))),
+		corev1ac.EnvVar().
+			WithName("SHOP_NAME").
+			WithValue(shop.Name),
+	}
+	if c.opts.OTLPEndpoint != "" {
+		env = append(env, corev1ac.EnvVar().
+			WithName("OTEL_EXPORTER_OTLP_ENDPOINT").
+			WithValue(c.opts.OTLPEndpoint))
+	}
+
+	args := []string{"serve", "/config/directions.json",
+		"--inventory-store=" + inventoryStore,
+		"--coins=" + strconv.Itoa(coins),
+		"--auth=" + c.opts.WorkerAuth,
+	}
+	if len(shop.Spec.AllowKingdoms) > 0 {
+		args = append(args, "--auth-kingdoms="+strings.Join(shop.Spec.AllowKingdoms, ","))
+	}
+	if len(shop.Spec.AllowShops) > 0 {
+		args = append(args, "--auth-shops="+strings.Join(shop.Spec.AllowShops, ","))
+	}
+
+	container := corev1ac.Container().
+		WithName(shop.Name).
+		WithImage(image).
+		WithImagePullPolicy(corev1.PullNever).
+		WithArgs(args...).
+		WithEnv(env...).
+		WithPorts(
+			corev1ac.ContainerPort().
+				WithName("http").
+				WithContainerPort(8080).
+				WithProtocol(corev1.ProtocolTCP),
+			corev1ac.ContainerPort().
+				WithName("grpc").
+				WithContainerPort(9090).
+				WithProtocol(corev1.ProtocolTCP)).
+		WithVolumeMounts(
+			corev1ac.VolumeMount().
+				WithName("config").
+				WithMountPath("/config").
+				WithReadOnly(true),
+			corev1ac.VolumeMount().
+				WithName("data").
+				WithMountPath("/data"),
+			corev1ac.VolumeMount().
+				WithName("civ-token").
+				WithMountPath(path.Dir(auth.DefaultTokenFile)).
+				WithReadOnly(true),
+		).
+		WithLivenessProbe(corev1ac.Probe().
+			WithHTTPGet(corev1ac.HTTPGetAction().WithPath("/live").WithPort(intstr.FromString("http"))).
+			WithInitialDelaySeconds(1).
+			WithPeriodSeconds(20)).
+		WithReadinessProbe(corev1ac.Probe().
+			WithHTTPGet(corev1ac.HTTPGetAction().WithPath("/ready").WithPort(intstr.FromString("http"))).
+			WithInitialDelaySeconds(5).
+			WithPeriodSeconds(10))
+
+	spec := appsv1ac.DeploymentSpec()
+	if shop.Spec.Replicas != nil {
+		// without replicas the controller gives up ownership of the field, so civ autoscale can set it
+		spec.WithReplicas(*shop.Spec.Replicas)
+	}
+	return appsv1ac.Deployment(shop.Name, shop.Namespace).
+		WithLabels(labels).
+		WithOwnerReferences(owner).
+		WithSpec(spec.
+			WithSelector(metav1ac.LabelSelector().WithMatchLabels(labels)).
+			WithTemplate(corev1ac.PodTemplateSpec().
+				WithLabels(labels).
+				WithSpec(corev1ac.PodSpec().
+					WithServiceAccountName(WorkerServiceAccount).
+					WithContainers(container).
+					WithVolumes(
+						corev1ac.Volume().
+							WithName("config").
+							WithConfigMap(corev1ac.ConfigMapVolumeSource().
+								WithName(shop.Name+"-directions")),
+						corev1ac.Volume().
+							WithName("data").
+							WithEmptyDir(corev1ac.EmptyDirVolumeSource()),
+						// the token the worker sends to its stores, only good for other shops
+						corev1ac.Volume().
+							WithName("civ-token").
+							WithProjected(corev1ac.ProjectedVolumeSource().
+								WithSources(corev1ac.VolumeProjection().
+									WithServiceAccountToken(corev1ac.ServiceAccountTokenProjection().
+										WithAudience(auth.Audience).
+										WithExpirationSeconds(3600).
+										WithPath(path.Base(auth.DefaultTokenFile))))),
+					))))
+}
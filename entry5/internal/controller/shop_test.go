@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	civv1alpha1 "github.com/Potokar1/k8s-research/entry5/internal/apis/civ/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestController returns a controller on fake clients, with the shop in the dynamic client and the informer cache
+func newTestController(t *testing.T, shop civv1alpha1.Shop) (*Controller, *fake.Clientset, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	shop.TypeMeta = metav1.TypeMeta{APIVersion: civv1alpha1.GroupVersion.String(), Kind: KindShop}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&shop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &unstructured.Unstructured{Object: content}
+
+	kube := fake.NewClientset()
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		civv1alpha1.KingdomResource: "KingdomList",
+		civv1alpha1.TownResource:    "TownList",
+		civv1alpha1.ShopResource:    "ShopList",
+	}, u)
+	c := NewController(kube, dyn, Options{WorkerAuth: "enforce"})
+	if err := c.shops.GetIndexer().Add(u); err != nil {
+		t.Fatal(err)
+	}
+	return c, kube, dyn
+}
+
+// shopCondition returns the DirectionsValid condition of the shop as stored by the controller
+func shopCondition(t *testing.T, dyn *dynamicfake.FakeDynamicClient, namespace, name string) *metav1.Condition {
+	t.Helper()
+	u, err := dyn.Resource(civv1alpha1.ShopResource).Namespace(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shop civv1alpha1.Shop
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &shop); err != nil {
+		t.Fatal(err)
+	}
+	return meta.FindStatusCondition(shop.Status.Conditions, civv1alpha1.ShopConditionDirectionsValid)
+}
+
+func TestReconcileShop(t *testing.T) {
+	ctx := context.Background()
+	shop := civv1alpha1.Shop{
+		ObjectMeta: metav1.ObjectMeta{Name: "ironworker", Namespace: "kingdom-of-foobar", UID: "uid-1"},
+		Spec: civv1alpha1.ShopSpec{
+			Town:       "simple-town",
+			AllowShops: []string{"craftsman"},
+			Directions: []civv1alpha1.Direction{{
+				Product:          "iron",
+				Amount:           1,
+				Interval:         10,
+				Price:            20,
+				ProductInputList: []civv1alpha1.ProductInput{{Product: "wood", Store: "http://woodworker", Amount: 10}},
+			}},
+		},
+	}
+	c, kube, dyn := newTestController(t, shop)
+
+	if err := c.Reconcile(ctx, KindShop, shop.Namespace, shop.Name); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	configMap, err := kube.CoreV1().ConfigMaps(shop.Namespace).Get(ctx, "ironworker-directions", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("directions configmap not created: %v", err)
+	}
+	if !strings.Contains(configMap.Data["directions.json"], `"product":"iron"`) {
+		t.Errorf("directions.json = %s, want the iron direction", configMap.Data["directions.json"])
+	}
+	deployment, err := kube.AppsV1().Deployments(shop.Namespace).Get(ctx, shop.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("deployment not created: %v", err)
+	}
+	args := strings.Join(deployment.Spec.Template.Spec.Containers[0].Args, " ")
+	for _, want := range []string{"--auth=enforce", "--auth-shops=craftsman"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args %q are missing %s", args, want)
+		}
+	}
+	if owner := metav1.GetControllerOf(deployment); owner == nil || owner.Kind != KindShop || owner.Name != shop.Name {
+		t.Errorf("deployment is controlled by %v, want the shop", owner)
+	}
+	if _, err := kube.CoreV1().Services(shop.Namespace).Get(ctx, shop.Name, metav1.GetOptions{}); err != nil {
+		t.Errorf("service not created: %v", err)
+	}
+	if cond := shopCondition(t, dyn, shop.Namespace, shop.Name); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Errorf("condition = %+v, want DirectionsValid true", cond)
+	}
+}
+
+func TestReconcileShopInvalidDirections(t *testing.T) {
+	ctx := context.Background()
+	shop := civv1alpha1.Shop{
+		ObjectMeta: metav1.ObjectMeta{Name: "woodworker", Namespace: "kingdom-of-foobar", UID: "uid-2"},
+		Spec: civv1alpha1.ShopSpec{
+			Town:       "simple-town",
+			Directions: []civv1alpha1.Direction{{Product: "wood", Amount: 0, Interval: 5}},
+		},
+	}
+	c, kube, dyn := newTestController(t, shop)
+
+	if err := c.Reconcile(ctx, KindShop, shop.Namespace, shop.Name); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	if _, err := kube.AppsV1().Deployments(shop.Namespace).Get(ctx, shop.Name, metav1.GetOptions{}); err == nil {
+		t.Error("deployment created for invalid directions")
+	}
+	if _, err := kube.CoreV1().ConfigMaps(shop.Namespace).Get(ctx, "woodworker-directions", metav1.GetOptions{}); err == nil {
+		t.Error("directions configmap created for invalid directions")
+	}
+	cond := shopCondition(t, dyn, shop.Namespace, shop.Name)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != "InvalidDirections" {
+		t.Fatalf("condition = %+v, want DirectionsValid false", cond)
+	}
+	if !strings.Contains(cond.Message, "directions[0].amount") {
+		t.Errorf("message %q doesn't name the invalid field", cond.Message)
+	}
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"context"
+	"slices"
+
+	civv1alpha1 "github.com/Potokar1/k8s-research/entry5/internal/apis/civ/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// reconcileTown records which shops belong to the town.
+// A town has no objects of its own, it is the town label on the objects of its shops.
+func (c *Controller) reconcileTown(ctx context.Context, namespace, name string) error {
+	town, err := get[civv1alpha1.Town](c.towns, namespace, name)
+	if err != nil || town == nil {
+		return err
+	}
+
+	var shops []string
+	for _, obj := range c.shops.GetStore().List() {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok || u.GetNamespace() != namespace {
+			continue
+		}
+		if shopTown, _, _ := unstructured.NestedString(u.Object, "spec", "town"); shopTown == name {
+			shops = append(shops, u.GetName())
+		}
+	}
+	slices.Sort(shops)
+	if slices.Equal(shops, town.Status.Shops) {
+		return nil
+	}
+	town.Status.Shops = shops
+	return c.updateStatus(ctx, civv1alpha1.TownResource, namespace, town)
+}
@@ -1,8 +1,7 @@
 package k8s
 
 import (
-	"os"
-	"path/filepath"
+	"fmt"
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -11,28 +10,76 @@ import (
 
 const (
 	TownLabel = "town"
+	ShopLabel = "shop"
+
+	// InventoryAnnotation is the pod annotation that holds the json encoded InventoryDocument of a worker
+	InventoryAnnotation = "civ.k8s-research/inventory"
 )
 
-// GetClientSet returns a kubernetes clientset from any found kubeconfig
-func GetClientSet() *kubernetes.Clientset {
-	// load kubeconfig
-	cfg, err := rest.InClusterConfig()
+// Options selects which cluster the client talks to
+type Options struct {
+	Kubeconfig string // Kubeconfig is the path to a kubeconfig file, empty uses $KUBECONFIG or ~/.kube/config
+	Context    string // Context is the kubeconfig context to use, empty uses the current context
+	Namespace  string // Namespace is the default namespace, empty uses the namespace of the context
+}
+
+// Client wraps a kubernetes clientset. It is built once and shared by every caller.
+type Client struct {
+	clientset kubernetes.Interface
+	config    *rest.Config
+	namespace string
+}
+
+// NewClient builds a client from a kubeconfig, falling back to the in-cluster config
+func NewClient(opts Options) (*Client, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = opts.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: opts.Context,
+	}
+	overrides.Context.Namespace = opts.Namespace
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	cfg, err := clientConfig.ClientConfig()
 	if err != nil {
-		// fall back to local kubeconfig
-		homeDir, _ := os.UserHomeDir()
-		kubeconfig := filepath.Join(homeDir, ".kube", "config")
-		cfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			// panic as we can't continue without a clientset and we should be able to use in-cluster/default config
-			panic(err)
-		}
+		return nil, fmt.Errorf("error loading kubeconfig: %w", err)
+	}
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("error loading namespace: %w", err)
 	}
 
-	// create clientset
 	clientset, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
-		// panic as we can't continue without a clientset
-		panic(err)
+		return nil, fmt.Errorf("error creating clientset: %w", err)
 	}
-	return clientset
+
+	return &Client{
+		clientset: clientset,
+		config:    cfg,
+		namespace: namespace,
+	}, nil
+}
+
+// NewClientFromInterface wraps an existing clientset, such as the one from k8s.io/client-go/kubernetes/fake
+func NewClientFromInterface(clientset kubernetes.Interface, namespace string) *Client {
+	return &Client{
+		clientset: clientset,
+		namespace: namespace,
+	}
+}
+
+// Interface returns the wrapped clientset
+func (c *Client) Interface() kubernetes.Interface {
+	return c.clientset
+}
+
+// RestConfig returns the config the client was built from, nil for wrapped clientsets
+func (c *Client) RestConfig() *rest.Config {
+	return c.config
+}
+
+// Namespace returns the default namespace of the client
+func (c *Client) Namespace() string {
+	return c.namespace
 }
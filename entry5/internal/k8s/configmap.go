@@ -0,0 +1,54 @@
+package k8s
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetConfigMapData returns the data and resource version of a ConfigMap.
+// A ConfigMap that does not exist returns no data and an empty resource version.
+func (c *Client) GetConfigMapData(ctx context.Context, namespace, name string) (map[string]string, string, error) {
+	cm, err := c.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return cm.Data, cm.ResourceVersion, nil
+}
+
+// SaveConfigMapData replaces the data of a ConfigMap.
+// An empty resource version creates the ConfigMap, otherwise the update fails with a conflict
+// if the ConfigMap was changed since it was read.
+func (c *Client) SaveConfigMapData(ctx context.Context, namespace, name string, labels, data map[string]string, resourceVersion string) error {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       namespace,
+			Labels:          labels,
+			ResourceVersion: resourceVersion,
+		},
+		Data: data,
+	}
+	if resourceVersion == "" {
+		_, err := c.clientset.CoreV1().ConfigMaps(namespace).Create(ctx, cm, metav1.CreateOptions{})
+		return err
+	}
+	_, err := c.clientset.CoreV1().ConfigMaps(namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
+
+// ListConfigMaps returns the ConfigMaps in a namespace matching the label selector
+func (c *Client) ListConfigMaps(ctx context.Context, namespace, labelSelector string) ([]corev1.ConfigMap, error) {
+	configMaps, err := c.clientset.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labelSelector,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return configMaps.Items, nil
+}
@@ -10,10 +10,8 @@ import (
 )
 
 // ListContainers returns the names of containers in a Pod
-func ListContainers(ctx context.Context, namespace, podName string) ([]string, error) {
-	clientset := GetClientSet()
-
-	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+func (c *Client) ListContainers(ctx context.Context, namespace, podName string) ([]string, error) {
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -26,10 +24,8 @@ func ListContainers(ctx context.Context, namespace, podName string) ([]string, e
 }
 
 // GetContainerLogs retrieves logs from a specific container in a Pod
-func GetContainerLogs(ctx context.Context, namespace, podName string) (string, error) {
-	clientset := GetClientSet()
-
-	req := clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{})
+func (c *Client) GetContainerLogs(ctx context.Context, namespace, podName string) (string, error) {
+	req := c.clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{})
 
 	podLogs, err := req.Stream(ctx)
 	if err != nil {
@@ -7,10 +7,8 @@ import (
 )
 
 // ListDeployments returns the the unique set of deployment labels in a namespace
-func ListDeployments(ctx context.Context, namespace string) ([]string, error) {
-	clientset := GetClientSet()
-
-	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+func (c *Client) ListDeployments(ctx context.Context, namespace string) ([]string, error) {
+	deployments, err := c.clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -29,3 +27,40 @@ func ListDeployments(ctx context.Context, namespace string) ([]string, error) {
 	}
 	return deploymentNames, nil
 }
+
+// ShopReplicas returns the desired replicas of each shop deployment in a namespace, keyed by the shop label.
+// An empty town returns the shops of every town.
+func (c *Client) ShopReplicas(ctx context.Context, namespace string, town string) (map[string]int32, error) {
+	selector := ShopLabel
+	if town != "" {
+		selector += "," + TownLabel + "=" + town
+	}
+	deployments, err := c.clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := make(map[string]int32, len(deployments.Items))
+	for _, deployment := range deployments.Items {
+		shop := deployment.Labels[ShopLabel]
+		if deployment.Spec.Replicas != nil {
+			replicas[shop] = *deployment.Spec.Replicas
+		} else {
+			replicas[shop] = 1 // the default of a deployment
+		}
+	}
+	return replicas, nil
+}
+
+// ScaleDeployment sets the replicas of a deployment through its scale subresource
+func (c *Client) ScaleDeployment(ctx context.Context, namespace string, name string, replicas int32) error {
+	scale, err := c.clientset.AppsV1().Deployments(namespace).GetScale(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	scale.Spec.Replicas = replicas
+	_, err = c.clientset.AppsV1().Deployments(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+	return err
+}
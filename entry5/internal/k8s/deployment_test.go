@@ -0,0 +1,37 @@
+package k8s
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func deployment(namespace, name, town string) *appsv1.Deployment {
+	return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels:    map[string]string{TownLabel: town, ShopLabel: name},
+	}}
+}
+
+func TestListDeployments(t *testing.T) {
+	client := NewClientFromInterface(fake.NewClientset(
+		deployment("kingdom-of-foobar", "woodworker", "simple-town"),
+		deployment("kingdom-of-foobar", "ironworker", "simple-town"),
+		deployment("kingdom-of-foobar", "craftsman", "other-town"),
+		deployment("kingdom-of-bar", "stoneworker", "far-town"),
+	), "kingdom-of-foobar")
+
+	towns, err := client.ListDeployments(context.Background(), "kingdom-of-foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(towns)
+	if want := []string{"other-town", "simple-town"}; !slices.Equal(towns, want) {
+		t.Errorf("ListDeployments = %v, want %v", towns, want)
+	}
+}
@@ -0,0 +1,118 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// WorkerEventSource is the source component of the Events workers record
+const WorkerEventSource = "civ-worker"
+
+// PodEventRecorder records Events against a single pod.
+// Events are rate limited and aggregated by client-go before they reach the API server.
+type PodEventRecorder struct {
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	pod         *corev1.Pod
+	annotations map[string]string // annotations carry the town and shop of the pod, so events can be filtered by town
+}
+
+// NewPodEventRecorder creates a recorder for the Events of a pod. Shutdown stops it.
+func (c *Client) NewPodEventRecorder(ctx context.Context, namespace string, podName string) (*PodEventRecorder, error) {
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting pod for events: %w", err)
+	}
+	// the Event reference needs the kind, which a typed get leaves empty
+	pod.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Pod"))
+
+	broadcaster := record.NewBroadcaster(
+		record.WithContext(ctx),
+		record.WithCorrelatorOptions(record.CorrelatorOptions{
+			// rate limit each reason on its own, so frequent Produced events never hide a PurchaseFailed
+			SpamKeyFunc: func(event *corev1.Event) string {
+				return event.Source.Component + "/" + event.InvolvedObject.Namespace + "/" + event.InvolvedObject.Name + "/" + event.Reason
+			},
+		}),
+	)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: c.clientset.CoreV1().Events(namespace)})
+
+	return &PodEventRecorder{
+		broadcaster: broadcaster,
+		recorder:    broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: WorkerEventSource, Host: pod.Spec.NodeName}),
+		pod:         pod,
+		annotations: map[string]string{
+			TownLabel: pod.Labels[TownLabel],
+			ShopLabel: pod.Labels[ShopLabel],
+		},
+	}, nil
+}
+
+// Event records an Event of the given type (Normal or Warning) against the pod
+func (r *PodEventRecorder) Event(eventType, reason, message string) {
+	r.recorder.AnnotatedEventf(r.pod, r.annotations, eventType, reason, "%s", message)
+}
+
+// Shutdown stops recording and drops the Events not sent yet
+func (r *PodEventRecorder) Shutdown() {
+	r.broadcaster.Shutdown()
+}
+
+// ListWorkerEvents returns the Events recorded by workers in a namespace, oldest first.
+// An empty town returns the Events of every town.
+func (c *Client) ListWorkerEvents(ctx context.Context, namespace string, town string) ([]corev1.Event, string, error) {
+	events, err := c.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: workerEventSelector(),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	var filtered []corev1.Event
+	for _, event := range events.Items {
+		if InTown(event, town) {
+			filtered = append(filtered, event)
+		}
+	}
+	slices.SortFunc(filtered, func(a, b corev1.Event) int {
+		return EventTime(a).Compare(EventTime(b).Time)
+	})
+	return filtered, events.ResourceVersion, nil
+}
+
+// WatchWorkerEvents watches the Events recorded by workers in a namespace, starting after the resource version
+func (c *Client) WatchWorkerEvents(ctx context.Context, namespace string, resourceVersion string) (watch.Interface, error) {
+	return c.clientset.CoreV1().Events(namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector:   workerEventSelector(),
+		ResourceVersion: resourceVersion,
+	})
+}
+
+// InTown returns true if a worker Event belongs to the town. An empty town matches every Event.
+func InTown(event corev1.Event, town string) bool {
+	return town == "" || event.Annotations[TownLabel] == town
+}
+
+// EventTime returns the last time an Event happened
+func EventTime(event corev1.Event) metav1.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp
+	case !event.EventTime.IsZero():
+		return metav1.NewTime(event.EventTime.Time)
+	default:
+		return event.CreationTimestamp
+	}
+}
+
+func workerEventSelector() string {
+	return fields.OneTermEqualSelector("source", WorkerEventSource).String()
+}
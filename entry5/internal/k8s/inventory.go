@@ -0,0 +1,49 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// InventoryDocumentVersion is the version of the InventoryDocument written by this build
+const InventoryDocumentVersion = 1
+
+// InventoryDocument is everything a worker publishes about itself in the InventoryAnnotation of its pod.
+// The whole document replaces the previous one on every save, so products that are gone disappear with it.
+type InventoryDocument struct {
+	Version      int                  `json:"version"`
+	Sequence     int64                `json:"sequence"`               // Sequence increases with every save, so readers can drop documents older than the one they have
+	Inventory    map[string]int       `json:"inventory"`              // Inventory is the stock of each product
+	Wallet       int                  `json:"wallet"`                 // Wallet is the coins the worker owns
+	Prices       map[string]int       `json:"prices,omitempty"`       // Prices is the price of each product the worker makes
+	Rejected     map[string]int       `json:"rejected,omitempty"`     // Rejected are the units refused for lack of stock since the worker started
+	LastProduced map[string]time.Time `json:"lastProduced,omitempty"` // LastProduced is when each product was last made
+}
+
+// DecodeInventoryAnnotation returns the InventoryDocument in the annotations of a pod,
+// or nil if the worker never published one.
+func DecodeInventoryAnnotation(annotations map[string]string) (*InventoryDocument, error) {
+	data, ok := annotations[InventoryAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	var doc InventoryDocument
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, fmt.Errorf("error decoding inventory annotation: %w", err)
+	}
+	if doc.Version != InventoryDocumentVersion {
+		return nil, fmt.Errorf("unsupported inventory annotation version %d, expected %d", doc.Version, InventoryDocumentVersion)
+	}
+	return &doc, nil
+}
+
+// EncodeInventoryAnnotation returns the annotations that publish the document, setting its version
+func EncodeInventoryAnnotation(doc InventoryDocument) (map[string]string, error) {
+	doc.Version = InventoryDocumentVersion
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{InventoryAnnotation: string(data)}, nil
+}
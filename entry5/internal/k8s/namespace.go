@@ -8,12 +8,9 @@ import (
 )
 
 // ListNamespaces returns a list of namespaces
-func ListNamespaces(ctx context.Context) ([]string, error) {
-	// get clientset
-	clientset := GetClientSet()
-
+func (c *Client) ListNamespaces(ctx context.Context) ([]string, error) {
 	// list namespaces
-	namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	namespaces, err := c.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -27,8 +24,11 @@ func ListNamespaces(ctx context.Context) ([]string, error) {
 }
 
 // ListAllPodsInNamespace returns a list of all pods in a given namespace
-func ListAllPodsInNamespace(ctx context.Context, namespace string) ([]string, error) {
-	pods := GetAllPodsInNamespace(ctx, namespace) // this is a helper function to get all pods in a namespace
+func (c *Client) ListAllPodsInNamespace(ctx context.Context, namespace string) ([]string, error) {
+	pods, err := c.GetAllPodsInNamespace(ctx, namespace) // this is a helper function to get all pods in a namespace
+	if err != nil {
+		return nil, err
+	}
 
 	// return pod names
 	var allPods []string
@@ -41,16 +41,13 @@ func ListAllPodsInNamespace(ctx context.Context, namespace string) ([]string, er
 }
 
 // GetAllPodsInNamespace returns a slice of all pods in a given namespace
-func GetAllPodsInNamespace(ctx context.Context, namespace string) []v1.Pod {
-	// get clientset
-	clientset := GetClientSet()
-
+func (c *Client) GetAllPodsInNamespace(ctx context.Context, namespace string) ([]v1.Pod, error) {
 	// list pods
-	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		return []v1.Pod{}
+		return nil, err
 	}
 
 	// return pod items
-	return pods.Items
+	return pods.Items, nil
 }
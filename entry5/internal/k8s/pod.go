@@ -3,17 +3,26 @@ package k8s
 import (
 	"context"
 	"encoding/json"
+	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
 )
 
-// ListPods returns the names of pods in a namespace with the given label
-func ListPods(ctx context.Context, namespace string, labelValue string) ([]string, error) {
-	clientset := GetClientSet()
+// tracer starts the spans of the kubernetes calls made for a worker
+var tracer = otel.Tracer("github.com/Potokar1/k8s-research/entry5/internal/k8s")
 
-	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+// ListPods returns the names of pods in a namespace with the given label
+func (c *Client) ListPods(ctx context.Context, namespace string, labelValue string) ([]string, error) {
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
 		LabelSelector: TownLabel + "=" + labelValue,
 	})
 	if err != nil {
@@ -27,52 +36,99 @@ func ListPods(ctx context.Context, namespace string, labelValue string) ([]strin
 	return podNames, nil
 }
 
-type podModifiedEvent struct {
-	PodName   string            `json:"pod_name"`
-	Inventory map[string]string `json:"inventory"`
+// PodEventType is the kind of change to a pod
+type PodEventType string
+
+const (
+	PodAdded   PodEventType = "ADDED"
+	PodUpdated PodEventType = "UPDATED"
+	PodDeleted PodEventType = "DELETED"
+)
+
+// PodEvent is a change to a pod seen by WatchPods
+type PodEvent struct {
+	Type      PodEventType
+	PodName   string
+	Inventory *InventoryDocument // Inventory is what the worker published, nil before its first save and when the pod was deleted
+	Err       error              // Err is set when the inventory annotation could not be decoded
 }
 
-// WatchPods watches for changes to pod(s) given filters such as namespace and label
-func WatchPods(ctx context.Context, namespace string, labelValue string) (chan podModifiedEvent, error) {
-	clientset := GetClientSet()
+// podWatchResync is how often WatchPods sends every pod again as an update, even without changes
+const podWatchResync = 30 * time.Second
 
-	listOpts := metav1.ListOptions{}
-	if labelValue != "" {
-		listOpts.LabelSelector = TownLabel + "=" + labelValue
+// WatchPods watches the shop pods of a namespace through a shared informer.
+// An empty town watches the pods of every town. The informer lists before it watches,
+// so every existing pod is sent as added first, and it reconnects on its own when the API server ends the watch.
+// The channel is closed when the context is canceled.
+func (c *Client) WatchPods(ctx context.Context, namespace string, town string) (<-chan PodEvent, error) {
+	selector := ShopLabel
+	if town != "" {
+		selector = TownLabel + "=" + town
 	}
+	factory := informers.NewSharedInformerFactoryWithOptions(c.clientset, podWatchResync,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(lo *metav1.ListOptions) {
+			lo.LabelSelector = selector
+		}),
+	)
+	informer := factory.Core().V1().Pods().Informer()
 
-	watch, err := clientset.CoreV1().Pods(namespace).Watch(ctx, listOpts)
+	events := make(chan PodEvent)
+	send := func(event PodEvent) {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}
+	sendPod := func(eventType PodEventType, obj any) {
+		pod, ok := obj.(*corev1.Pod)
+		if !ok {
+			return
+		}
+		doc, err := DecodeInventoryAnnotation(pod.Annotations)
+		send(PodEvent{Type: eventType, PodName: pod.Name, Inventory: doc, Err: err})
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			sendPod(PodAdded, obj)
+		},
+		UpdateFunc: func(_, obj any) {
+			sendPod(PodUpdated, obj)
+		},
+		DeleteFunc: func(obj any) {
+			// a delete missed while the watch was down arrives as the last state the informer knew
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				send(PodEvent{Type: PodDeleted, PodName: pod.Name})
+			}
+		},
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Create a channel to send pod modified events
-	podModifiedChan := make(chan podModifiedEvent)
+	factory.Start(ctx.Done())
 	go func() {
-		defer close(podModifiedChan)
-		for event := range watch.ResultChan() {
-			pod, ok := event.Object.(*corev1.Pod)
-			if !ok {
-				continue // skip if the object is not a Pod
-			}
-			switch event.Type {
-			case "MODIFIED":
-				podModifiedChan <- podModifiedEvent{
-					PodName:   pod.Name,
-					Inventory: pod.Annotations,
-				}
-			}
-		}
+		<-ctx.Done()
+		factory.Shutdown() // waits for the handlers, so nothing sends on the closed channel
+		close(events)
 	}()
-	return podModifiedChan, nil
+	return events, nil
 }
 
-func PatchPod(ctx context.Context, namespace string, podName string, inventory map[string]string) error {
-	clientset := GetClientSet()
+// PatchPod merges the annotations into the annotations of a pod, leaving every other annotation alone
+func (c *Client) PatchPod(ctx context.Context, namespace string, podName string, annotations map[string]string) error {
+	ctx, span := tracer.Start(ctx, "Client.PatchPod", trace.WithAttributes(
+		attribute.String("k8s.namespace.name", namespace),
+		attribute.String("k8s.pod.name", podName),
+	))
+	defer span.End()
 
 	data := map[string]any{
 		"metadata": map[string]any{
-			"annotations": inventory,
+			"annotations": annotations,
 		},
 	}
 
@@ -86,6 +142,42 @@ func PatchPod(ctx context.Context, namespace string, podName string, inventory m
 	patchOptions := metav1.PatchOptions{
 		FieldValidation: strictFieldValidation,
 	}
-	_, err = clientset.CoreV1().Pods(namespace).Patch(ctx, podName, types.MergePatchType, dataBytes, patchOptions)
+	_, err = c.clientset.CoreV1().Pods(namespace).Patch(ctx, podName, types.MergePatchType, dataBytes, patchOptions)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
 	return err
 }
+
+// GetPodAnnotations returns the annotations of a pod
+func (c *Client) GetPodAnnotations(ctx context.Context, namespace string, podName string) (map[string]string, error) {
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return pod.Annotations, nil
+}
+
+// PodExists returns true if the pod exists in the namespace
+func (c *Client) PodExists(ctx context.Context, namespace string, podName string) (bool, error) {
+	_, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ListShopPods returns the pods of every shop in a namespace. An empty town returns the pods of every town.
+func (c *Client) ListShopPods(ctx context.Context, namespace string, town string) ([]corev1.Pod, error) {
+	selector := ShopLabel
+	if town != "" {
+		selector += "," + TownLabel + "=" + town
+	}
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
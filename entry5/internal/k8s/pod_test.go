@@ -0,0 +1,118 @@
+package k8s
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func pod(namespace, name, town, shop string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        name,
+		Namespace:   namespace,
+		Labels:      map[string]string{TownLabel: town, ShopLabel: shop},
+		Annotations: map[string]string{"kept": "yes"},
+	}}
+}
+
+func TestListPods(t *testing.T) {
+	client := NewClientFromInterface(fake.NewClientset(
+		pod("kingdom-of-foobar", "woodworker-0", "simple-town", "woodworker"),
+		pod("kingdom-of-foobar", "craftsman-0", "simple-town", "craftsman"),
+		pod("kingdom-of-foobar", "miner-0", "other-town", "miner"),
+		pod("kingdom-of-bar", "woodworker-1", "simple-town", "woodworker"),
+	), "kingdom-of-foobar")
+
+	pods, err := client.ListPods(context.Background(), "kingdom-of-foobar", "simple-town")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(pods)
+	if want := []string{"craftsman-0", "woodworker-0"}; !slices.Equal(pods, want) {
+		t.Errorf("ListPods = %v, want %v", pods, want)
+	}
+}
+
+func TestPatchPod(t *testing.T) {
+	ctx := context.Background()
+	kube := fake.NewClientset(pod("kingdom-of-foobar", "woodworker-0", "simple-town", "woodworker"))
+	client := NewClientFromInterface(kube, "kingdom-of-foobar")
+
+	annotations, err := EncodeInventoryAnnotation(InventoryDocument{Inventory: map[string]int{"wood": 5}, Wallet: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PatchPod(ctx, "kingdom-of-foobar", "woodworker-0", annotations); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := client.GetPodAnnotations(ctx, "kingdom-of-foobar", "woodworker-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["kept"] != "yes" {
+		t.Errorf("the patch dropped the other annotations: %v", got)
+	}
+	doc, err := DecodeInventoryAnnotation(got)
+	if err != nil || doc == nil || doc.Inventory["wood"] != 5 || doc.Wallet != 10 {
+		t.Errorf("inventory annotation = %+v, %v, want 5 wood and 10 coins", doc, err)
+	}
+
+	if err := client.PatchPod(ctx, "kingdom-of-foobar", "missing-0", annotations); err == nil {
+		t.Error("patching a missing pod succeeded")
+	}
+}
+
+func TestWatchPods(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	kube := fake.NewClientset(pod("kingdom-of-foobar", "woodworker-0", "simple-town", "woodworker"))
+	client := NewClientFromInterface(kube, "kingdom-of-foobar")
+
+	events, err := client.WatchPods(ctx, "kingdom-of-foobar", "simple-town")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func() PodEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no pod event")
+			return PodEvent{}
+		}
+	}
+
+	if event := next(); event.Type != PodAdded || event.PodName != "woodworker-0" || event.Inventory != nil {
+		t.Errorf("first event = %+v, want the existing pod added without inventory", event)
+	}
+
+	annotations, err := EncodeInventoryAnnotation(InventoryDocument{Inventory: map[string]int{"wood": 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PatchPod(ctx, "kingdom-of-foobar", "woodworker-0", annotations); err != nil {
+		t.Fatal(err)
+	}
+	if event := next(); event.Type != PodUpdated || event.Inventory == nil || event.Inventory.Inventory["wood"] != 3 {
+		t.Errorf("event after the patch = %+v, want an update with 3 wood", event)
+	}
+
+	if err := kube.CoreV1().Pods("kingdom-of-foobar").Delete(ctx, "woodworker-0", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if event := next(); event.Type != PodDeleted || event.PodName != "woodworker-0" {
+		t.Errorf("event after the delete = %+v, want the pod deleted", event)
+	}
+
+	cancel()
+	for range events {
+		// drained until WatchPods closes the channel
+	}
+}
@@ -0,0 +1,64 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// PortForward forwards a random local port to the port of a pod, like kubectl port-forward, and returns the local port.
+// The forward stops when the context is canceled or the connection to the pod breaks, the channel is closed then.
+func (c *Client) PortForward(ctx context.Context, namespace, podName string, port int) (int, <-chan struct{}, error) {
+	if c.config == nil {
+		return 0, nil, fmt.Errorf("port forwarding needs a client built from a kubeconfig")
+	}
+	transport, upgrader, err := spdy.RoundTripperFor(c.config)
+	if err != nil {
+		return 0, nil, err
+	}
+	url := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("portforward").
+		URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+
+	stop := make(chan struct{})
+	ready := make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"localhost"}, []string{"0:" + strconv.Itoa(port)}, stop, ready, io.Discard, io.Discard)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer close(done)
+		errs <- forwarder.ForwardPorts()
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		close(stop)
+	}()
+
+	select {
+	case <-ready:
+	case err := <-errs:
+		return 0, nil, fmt.Errorf("error forwarding to %s/%s: %w", namespace, podName, err)
+	}
+	ports, err := forwarder.GetPorts()
+	if err != nil || len(ports) == 0 {
+		forwarder.Close()
+		return 0, nil, fmt.Errorf("error forwarding to %s/%s: no local port", namespace, podName)
+	}
+	return int(ports[0].Local), done, nil
+}
@@ -0,0 +1,21 @@
+package k8s
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ListServices returns the names of services in a namespace
+func (c *Client) ListServices(ctx context.Context, namespace string) ([]string, error) {
+	services, err := c.clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var serviceNames []string
+	for _, service := range services.Items {
+		serviceNames = append(serviceNames, service.Name)
+	}
+	return serviceNames, nil
+}
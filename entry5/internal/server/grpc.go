@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+
+	shopv1 "github.com/Potokar1/k8s-research/entry5/internal/apis/shop/v1"
+	"github.com/Potokar1/k8s-research/entry5/internal/auth"
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// InitializeGRPC serves the Shop service of the worker on the gRPC server
+func (s *Server) InitializeGRPC(srv *grpc.Server) {
+	shopv1.RegisterShopServer(srv, &shopServer{server: s})
+}
+
+// shopServer is the Shop service, the gRPC side of the same worker as the REST API
+type shopServer struct {
+	shopv1.UnimplementedShopServer
+	server *Server
+}
+
+func (g *shopServer) Sell(ctx context.Context, req *shopv1.SellRequest) (*shopv1.SellResponse, error) {
+	if _, err := g.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if req.Product == "" || req.Quantity <= 0 || req.Payment < 0 {
+		return nil, status.Error(codes.InvalidArgument, "product must not be empty, quantity must be positive and payment must not be negative")
+	}
+	receipt, err := g.server.worker.Sell(ctx, req.Product, int(req.Quantity), int(req.Payment))
+	if err != nil {
+		return nil, grpcStatus(err)
+	}
+	return &shopv1.SellResponse{
+		Product:  receipt.Item,
+		Quantity: int64(receipt.Quantity),
+		Price:    int64(receipt.Price),
+		Total:    int64(receipt.Total),
+	}, nil
+}
+
+func (g *shopServer) GetInventory(ctx context.Context, req *shopv1.GetInventoryRequest) (*shopv1.GetInventoryResponse, error) {
+	ledger := g.server.worker.Ledger()
+	products := ledger.Inventory
+	for _, direction := range g.server.worker.Directions() {
+		products[direction.Product] += 0
+	}
+	resp := &shopv1.GetInventoryResponse{Wallet: int64(ledger.Wallet)}
+	for _, product := range slices.Sorted(maps.Keys(products)) {
+		item, _ := g.server.inventoryItem(product)
+		resp.Items = append(resp.Items, &shopv1.InventoryItem{
+			Product:   item.Product,
+			Amount:    int64(item.Amount),
+			Available: int64(item.Available),
+			Price:     int64(item.Price),
+			Minimum:   int64(item.Minimum),
+		})
+	}
+	return resp, nil
+}
+
+// StreamInventory sends the same events as /events, resuming after the last event ID when the worker still has the events after it
+func (g *shopServer) StreamInventory(req *shopv1.StreamInventoryRequest, stream grpc.ServerStreamingServer[shopv1.InventoryEvent]) error {
+	w := g.server.worker
+	after, resume := g.server.parseEventID(req.LastEventId)
+	events, notify, complete := w.Stream(after)
+	complete = complete && resume
+	for {
+		if !complete {
+			// start over from the ledger, the events after the snapshot carry absolute stock and wallet
+			after = w.LastEventID()
+			ledger := w.Ledger()
+			snapshot := &shopv1.InventoryEvent{
+				Id:        g.server.eventID(after),
+				Kind:      EventSnapshot,
+				Time:      timestamppb.Now(),
+				Wallet:    int64(ledger.Wallet),
+				Inventory: make(map[string]int64, len(ledger.Inventory)),
+			}
+			for product, amount := range ledger.Inventory {
+				snapshot.Inventory[product] = int64(amount)
+			}
+			if err := stream.Send(snapshot); err != nil {
+				return err
+			}
+			events, notify, _ = w.Stream(after)
+		}
+		for _, event := range events {
+			err := stream.Send(&shopv1.InventoryEvent{
+				Id:      g.server.eventID(event.ID),
+				Kind:    event.Kind,
+				Time:    timestamppb.New(event.Time),
+				Product: event.Product,
+				Amount:  int64(event.Amount),
+				Stock:   int64(event.Stock),
+				Total:   int64(event.Total),
+				Wallet:  int64(event.Wallet),
+			})
+			if err != nil {
+				return err
+			}
+			after = event.ID
+		}
+
+		select {
+		case <-notify:
+			events, notify, complete = w.Stream(after)
+		case <-stream.Context().Done():
+			return nil
+		case <-g.server.shutdown:
+			return status.Error(codes.Unavailable, "the worker is shutting down")
+		}
+	}
+}
+
+func (g *shopServer) PlaceOrder(ctx context.Context, req *shopv1.PlaceOrderRequest) (*shopv1.Order, error) {
+	id, err := g.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Product == "" || req.Quantity <= 0 || req.Payment < 0 {
+		return nil, status.Error(codes.InvalidArgument, "product must not be empty, quantity must be positive and payment must not be negative")
+	}
+	if !validCallback(req.Callback) {
+		return nil, status.Errorf(codes.InvalidArgument, "callback must be an http url, got %q", req.Callback)
+	}
+	order, err := g.server.worker.PlaceOrder(ctx, req.Product, int(req.Quantity), int(req.Payment), req.Callback, id.Principal(), req.Standing)
+	if err != nil {
+		return nil, grpcStatus(err)
+	}
+	return worker.OrderToProto(order), nil
+}
+
+func (g *shopServer) GetOrder(ctx context.Context, req *shopv1.GetOrderRequest) (*shopv1.Order, error) {
+	order, err := g.server.worker.Order(req.Id)
+	if err != nil {
+		return nil, grpcStatus(err)
+	}
+	return worker.OrderToProto(order), nil
+}
+
+// authorize checks the bearer token in the metadata of a call, like the Authorization header of the REST API
+func (g *shopServer) authorize(ctx context.Context) (auth.Identity, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token = auth.BearerToken(values[0])
+		}
+	}
+	id, err := g.server.auth.Authorize(ctx, token)
+	switch {
+	case err == nil:
+		return id, nil
+	case errors.Is(err, auth.ErrUnauthenticated):
+		err = status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, auth.ErrForbidden):
+		err = status.Error(codes.PermissionDenied, err.Error())
+	default:
+		err = status.Error(codes.Unavailable, err.Error())
+	}
+	slog.InfoContext(ctx, "turned a caller away", "user", id.Username, "error", err)
+	return id, err
+}
+
+// grpcStatus returns the status of an error of the worker, the counterpart of the status codes of the REST API
+func grpcStatus(err error) error {
+	switch {
+	case errors.Is(err, worker.ErrNotEnoughInventory):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, worker.ErrInsufficientPayment):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, worker.ErrOrderTooLarge):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, worker.ErrTooManyOrders):
+		// the same code as out of stock, the detail tells the buyer it is the order cap
+		st, detailErr := status.New(codes.ResourceExhausted, err.Error()).WithDetails(&errdetails.ErrorInfo{
+			Domain: worker.GRPCErrorDomain,
+			Reason: worker.ReasonTooManyOrders,
+		})
+		if detailErr != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		return st.Err()
+	case errors.Is(err, worker.ErrUnknownProduct), errors.Is(err, worker.ErrOrderNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventSnapshot is the kind of the first event of a stream that doesn't resume: the whole ledger.
+// The events after it are worker.StreamEvent changes to it.
+const EventSnapshot = "snapshot"
+
+// eventsKeepAlive is how often an idle stream sends a comment, so proxies don't close it
+const eventsKeepAlive = 15 * time.Second
+
+// restEvents streams the changes of the worker as Server-Sent Events: inventory changes, production, sales and purchases.
+// A stream resumes after the Last-Event-ID header (or the lastEventId query parameter) while the worker still has the events after it,
+// otherwise it starts with a snapshot of the ledger.
+func (s *Server) restEvents(w http.ResponseWriter, r *http.Request) {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	after, resume := s.parseEventID(lastEventID)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would hold the events back otherwise
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+
+	events, notify, complete := s.worker.Stream(after)
+	complete = complete && resume
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		if !complete {
+			// the events after the ID are gone, start over from the ledger. Events after the snapshot may already be in it,
+			// their stock and wallet are absolute, so applying them again is harmless.
+			after = s.worker.LastEventID()
+			ledger := s.worker.Ledger()
+			ledger.Prices = s.worker.Prices()
+			if !writeEvent(w, s.eventID(after), EventSnapshot, ledger) {
+				return
+			}
+			events, notify, _ = s.worker.Stream(after)
+		}
+		for _, event := range events {
+			if !writeEvent(w, s.eventID(event.ID), event.Kind, event) {
+				return
+			}
+			after = event.ID
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-notify:
+			// a reader that fell more than the ring buffer behind gets a new snapshot
+			events, notify, complete = s.worker.Stream(after)
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			events, complete = nil, true
+		case <-r.Context().Done():
+			return
+		case <-s.shutdown:
+			return
+		}
+	}
+}
+
+// eventID returns the SSE id of an event: the stream instance and the event ID, such as 1f2e3d4c-42
+func (s *Server) eventID(id uint64) string {
+	return s.worker.StreamInstance() + "-" + strconv.FormatUint(id, 10)
+}
+
+// parseEventID returns the event ID of an SSE id, false when the id is empty, malformed or from another stream instance
+func (s *Server) parseEventID(eventID string) (uint64, bool) {
+	instance, id, ok := strings.Cut(eventID, "-")
+	if !ok || instance != s.worker.StreamInstance() {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(id, 10, 64)
+	return n, err == nil
+}
+
+// writeEvent writes a single event with json data, false when the reader is gone
+func writeEvent(w http.ResponseWriter, id, kind string, data any) bool {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return false
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, kind, payload)
+	return err == nil
+}
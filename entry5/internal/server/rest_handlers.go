@@ -3,33 +3,80 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"sync"
 
+	"github.com/Potokar1/k8s-research/entry5/internal/auth"
 	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracer starts the spans of the REST API
+var tracer = otel.Tracer("github.com/Potokar1/k8s-research/entry5/internal/server")
+
 type Server struct {
 	client *http.Client
 
 	worker *worker.Worker
+	auth   *auth.Authenticator // auth checks the buyers, nil sells to anyone
+
+	shutdown     chan struct{} // shutdown is closed when the server shuts down, ending the event streams
+	shutdownOnce sync.Once
 }
 
 func NewServer(w *worker.Worker) *Server {
 	return &Server{
-		client: http.DefaultClient,
-		worker: w,
+		client:   http.DefaultClient,
+		worker:   w,
+		shutdown: make(chan struct{}),
 	}
 }
 
+// SetAuthenticator makes the server check the service account token of the callers that buy or cancel orders
+func (s *Server) SetAuthenticator(a *auth.Authenticator) {
+	s.auth = a
+}
+
+// Shutdown ends the event streams, which never go idle on their own, so the HTTP and gRPC servers can stop gracefully
+func (s *Server) Shutdown() {
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+}
+
 func (s *Server) InitializeREST(ctx context.Context, mux *http.ServeMux) {
 	// live and ready checks
-	mux.HandleFunc("/live", s.restLive)
-	mux.HandleFunc("/ready", s.restReady)
+	mux.HandleFunc("GET /live", s.restLive)
+	mux.HandleFunc("GET /ready", s.restReady)
 
 	// worker endpoints
-	mux.HandleFunc("/sell", s.restSell)
-	mux.HandleFunc("/inventory", s.restInventory)
+	mux.HandleFunc("POST /sell", s.restSell)
+	mux.HandleFunc("GET /inventory", s.restInventory)
+	mux.HandleFunc("GET /prices", s.restPrices)
+	mux.HandleFunc("GET /events", s.restEvents)
+
+	// typed API with problem+json errors
+	s.initializeRESTv2(mux)
+}
+
+// InitializeMetrics serves the prometheus metrics of the worker and the go runtime on /metrics
+func (s *Server) InitializeMetrics(mux *http.ServeMux) error {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if err := s.worker.RegisterMetrics(reg); err != nil {
+		return err
+	}
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}))
+	return nil
 }
 
 // restLive implements the REST API for the live check
@@ -50,7 +97,16 @@ func (s *Server) restReady(w http.ResponseWriter, r *http.Request) {
 
 // restSell implement the REST API for selling items from the worker
 func (s *Server) restSell(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	// continue the trace of the buyer
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "Server.restSell", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	if _, err := s.authorize(ctx, r); err != nil {
+		writeAuthHeader(w, err)
+		http.Error(w, err.Error(), authStatus(err))
+		return
+	}
 
 	// Handle the buy request
 	buyRequest, err := worker.DecodeBuyRequest(r)
@@ -58,30 +114,103 @@ func (s *Server) restSell(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	slog.DebugContext(ctx, "received sell request", "item", buyRequest.Item, "quantity", buyRequest.Quantity)
+	if buyRequest.Quantity <= 0 || buyRequest.Payment < 0 {
+		http.Error(w, "Quantity must be positive and payment must not be negative", http.StatusBadRequest)
+		return
+	}
+	slog.DebugContext(ctx, "received sell request", "item", buyRequest.Item, "quantity", buyRequest.Quantity, "payment", buyRequest.Payment)
+	span.SetAttributes(
+		attribute.String("civ.product", buyRequest.Item),
+		attribute.Int("civ.amount", buyRequest.Quantity),
+	)
 
 	// Sell the item(s)
-	if sold := s.worker.Sell(ctx, buyRequest.Item, buyRequest.Quantity); !sold {
+	receipt, err := s.worker.Sell(ctx, buyRequest.Item, buyRequest.Quantity, buyRequest.Payment)
+	switch {
+	case errors.Is(err, worker.ErrInsufficientPayment):
+		http.Error(w, "Insufficient payment", http.StatusPaymentRequired)
+		return
+	case errors.Is(err, worker.ErrNotEnoughInventory):
 		http.Error(w, "Not enough inventory", http.StatusConflict)
 		return
-
+	case errors.Is(err, worker.ErrUnknownProduct):
+		http.Error(w, "Unknown product", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	// Respond okay
+	// Respond with the receipt
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(receipt); err != nil {
+		slog.DebugContext(ctx, "error encoding receipt", "error", err)
+	}
 }
 
-// restInventory implements the REST API for getting the inventory of the worker
+// restInventory implements the REST API for getting the inventory and wallet of the worker
 func (s *Server) restInventory(w http.ResponseWriter, r *http.Request) {
-	// Get the inventory
-	invList := s.worker.InventoryList()
+	// Get the inventory and wallet
+	ledger := s.worker.Ledger()
 
-	// Respond with the inventory as JSON
-	w.WriteHeader(http.StatusOK)
+	// Respond with the ledger as JSON, the headers must be set before they are written
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(invList); err != nil {
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(ledger); err != nil {
 		slog.Debug("error encoding inventory", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	}
+}
+
+// restPrices implements the REST API for getting the current prices of the worker's products
+func (s *Server) restPrices(w http.ResponseWriter, r *http.Request) {
+	prices := s.worker.Prices()
+
+	// Respond with the prices as JSON
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(prices); err != nil {
+		slog.Debug("error encoding prices", "error", err)
+	}
+}
+
+// authorize checks the bearer token of a request that takes from the stock of the worker, and notes the buyer on the span
+func (s *Server) authorize(ctx context.Context, r *http.Request) (auth.Identity, error) {
+	id, err := s.auth.Authorize(ctx, auth.BearerToken(r.Header.Get("Authorization")))
+	if id.Username != "" {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("enduser.id", id.Username), attribute.String("civ.buyer", id.Shop))
+	}
+	if err != nil {
+		slog.InfoContext(ctx, "turned a caller away", "user", id.Username, "error", err)
+	}
+	return id, err
+}
+
+// authorizeWorker checks that the bearer token of a request belongs to a shop worker, whatever the policy of the shop
+func (s *Server) authorizeWorker(ctx context.Context, r *http.Request) error {
+	id, err := s.auth.AuthorizeWorker(ctx, auth.BearerToken(r.Header.Get("Authorization")))
+	if err != nil {
+		slog.InfoContext(ctx, "turned a caller away", "user", id.Username, "error", err)
+	}
+	return err
+}
+
+// authStatus returns the status of a caller that was turned away: 401 without a valid token,
+// 403 when the policy doesn't allow the caller, 503 when the token could not be reviewed
+func authStatus(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, auth.ErrForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusServiceUnavailable
+	}
+}
+
+// writeAuthHeader asks for a bearer token on 401 responses, it has to be set before the status is written
+func writeAuthHeader(w http.ResponseWriter, err error) {
+	if errors.Is(err, auth.ErrUnauthenticated) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="civ"`)
 	}
 }
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+)
+
+// ledgerStore restores a fixed ledger and drops every save
+type ledgerStore struct {
+	ledger worker.Ledger
+}
+
+func (s ledgerStore) Load(ctx context.Context) (*worker.Ledger, error) {
+	return &s.ledger, nil
+}
+
+func (s ledgerStore) Save(ctx context.Context, ledger worker.Ledger) error {
+	return nil
+}
+
+// newTestServer serves the REST API of a woodworker with the given stock of wood
+func newTestServer(t *testing.T, wood int) (*httptest.Server, *worker.Worker) {
+	t.Helper()
+	directions := []worker.Direction{{Product: "wood", Amount: 1, Interval: 1, Price: 1}}
+	w := worker.NewWorker("kingdom-of-foobar", "woodworker-0", directions, 0, ledgerStore{worker.Ledger{Inventory: map[string]int{"wood": wood}}})
+	if err := w.Restore(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	NewServer(w).InitializeREST(context.Background(), mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, w
+}
+
+func sell(t *testing.T, url string, req worker.BuyRequest) int {
+	t.Helper()
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	resp, err := http.Post(url+"/sell", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// TestSellConcurrent hammers /sell from many buyers at once, run it with go test -race.
+// The inventory must never go below zero, and every unit sold must be paid for exactly once.
+func TestSellConcurrent(t *testing.T) {
+	const stock, buyers, quantity = 100, 300, 2
+	srv, w := newTestServer(t, stock)
+
+	done := make(chan struct{})
+	var negative atomic.Bool
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if w.Ledger().Inventory["wood"] < 0 {
+				negative.Store(true)
+			}
+		}
+	}()
+
+	var sold, conflicts atomic.Int64
+	var wg sync.WaitGroup
+	for range buyers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch status := sell(t, srv.URL, worker.BuyRequest{Item: "wood", Quantity: quantity, Payment: 1_000_000}); status {
+			case http.StatusOK:
+				sold.Add(quantity)
+			case http.StatusConflict:
+				conflicts.Add(1)
+			default:
+				t.Errorf("status %d, want 200 or 409", status)
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+
+	if negative.Load() {
+		t.Error("the inventory went below zero")
+	}
+	left := w.Ledger().Inventory["wood"]
+	if left < 0 || int(sold.Load())+left != stock {
+		t.Errorf("sold %d and %d left, want %d in total", sold.Load(), left, stock)
+	}
+	if sold.Load() != stock {
+		t.Errorf("sold %d, want the whole stock of %d", sold.Load(), stock)
+	}
+	if conflicts.Load() != buyers-stock/quantity {
+		t.Errorf("%d buyers were turned away, want %d", conflicts.Load(), buyers-stock/quantity)
+	}
+	if w.Wallet() <= 0 {
+		t.Errorf("wallet = %d, want the sales paid for", w.Wallet())
+	}
+}
+
+func TestSellRejectsInvalidQuantity(t *testing.T) {
+	srv, w := newTestServer(t, 10)
+
+	for _, quantity := range []int{0, -5} {
+		if status := sell(t, srv.URL, worker.BuyRequest{Item: "wood", Quantity: quantity, Payment: 100}); status != http.StatusBadRequest {
+			t.Errorf("quantity %d: status %d, want 400", quantity, status)
+		}
+	}
+	if status := sell(t, srv.URL, worker.BuyRequest{Item: "iron", Quantity: 1, Payment: 100}); status != http.StatusNotFound {
+		t.Errorf("unknown product: status %d, want 404", status)
+	}
+	if got := w.Ledger().Inventory["wood"]; got != 10 {
+		t.Errorf("wood = %d, want the stock untouched", got)
+	}
+	if got := w.Rejected()["wood"]; got != 0 {
+		t.Errorf("rejected = %d, want invalid requests not counted", got)
+	}
+}
@@ -0,0 +1,354 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// openAPI describes /api/v2, served on /api/v2/openapi.json
+//
+//go:embed openapi.json
+var openAPI []byte
+
+// Problem types of /api/v2, other errors are about:blank with the title of their status
+const (
+	ProblemInvalidRequest      = "https://potokar1.github.io/k8s-research/entry5/problems/invalid-request"
+	ProblemOutOfStock          = "https://potokar1.github.io/k8s-research/entry5/problems/out-of-stock"
+	ProblemInsufficientPayment = "https://potokar1.github.io/k8s-research/entry5/problems/insufficient-payment"
+	ProblemUnknownProduct      = "https://potokar1.github.io/k8s-research/entry5/problems/unknown-product"
+	ProblemOrderSettled        = "https://potokar1.github.io/k8s-research/entry5/problems/order-settled"
+	ProblemNotOrderOwner       = "https://potokar1.github.io/k8s-research/entry5/problems/not-order-owner"
+	ProblemTooManyOrders       = "https://potokar1.github.io/k8s-research/entry5/problems/too-many-orders"
+)
+
+// maxRequestBody is the largest request body /api/v2 reads
+const maxRequestBody = 1 << 20
+
+// Problem is an RFC 7807 problem details error, sent as application/problem+json
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"` // Instance is the path of the request that failed
+}
+
+// InventoryItem is the stock and price of a single product
+type InventoryItem struct {
+	Product   string `json:"product"`
+	Amount    int    `json:"amount"`    // Amount is the stock on hand
+	Available int    `json:"available"` // Available is the stock not held by a sale or production in progress
+	Price     int    `json:"price"`     // Price is the current price of a single unit, 0 for products the worker doesn't make
+	Minimum   int    `json:"minimum"`   // Minimum is the stock the worker keeps to be ready
+}
+
+// OrderRequest is the body of POST /api/v2/orders
+type OrderRequest struct {
+	Product  string `json:"product"`
+	Quantity int    `json:"quantity"`
+	Payment  int    `json:"payment"`            // Payment is the most the buyer is willing to pay
+	Standing bool   `json:"standing,omitempty"` // Standing keeps the order in the order book until there is stock
+	Callback string `json:"callback,omitempty"` // Callback is the URL a standing order is posted to once it is settled
+}
+
+// initializeRESTv2 serves /api/v2. Every route answers other methods with 405 and unknown paths with 404, as problem+json.
+func (s *Server) initializeRESTv2(mux *http.ServeMux) {
+	routes := []struct {
+		method  string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{http.MethodGet, "/api/v2/inventory", s.restV2Inventory},
+		{http.MethodGet, "/api/v2/inventory/{product}", s.restV2InventoryItem},
+		{http.MethodGet, "/api/v2/directions", s.restV2Directions},
+		{http.MethodGet, "/api/v2/orders", s.restV2Orders},
+		{http.MethodPost, "/api/v2/orders", s.restV2CreateOrder},
+		{http.MethodGet, "/api/v2/orders/{id}", s.restV2Order},
+		{http.MethodDelete, "/api/v2/orders/{id}", s.restV2CancelOrder},
+		{http.MethodPost, "/api/v2/deliveries", s.restV2Deliver},
+		{http.MethodGet, "/api/v2/openapi.json", s.restV2OpenAPI},
+	}
+	allowed := make(map[string][]string)
+	var paths []string
+	for _, route := range routes {
+		mux.HandleFunc(route.method+" "+route.path, route.handler)
+		if _, ok := allowed[route.path]; !ok {
+			paths = append(paths, route.path)
+		}
+		allowed[route.path] = append(allowed[route.path], route.method)
+	}
+	// a pattern without a method only gets the requests no method pattern took
+	for _, path := range paths {
+		methods := allowed[path]
+		if slices.Contains(methods, http.MethodGet) {
+			methods = append(methods, http.MethodHead)
+		}
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			writeProblem(w, r, http.StatusMethodNotAllowed, "", fmt.Sprintf("%s is not allowed, use %s", r.Method, strings.Join(methods, " or ")))
+		})
+	}
+	mux.HandleFunc("/api/v2/", func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, http.StatusNotFound, "", "no such resource, see /api/v2/openapi.json")
+	})
+}
+
+// restV2Inventory lists the stock of every product in the inventory or made by the worker, sorted by product
+func (s *Server) restV2Inventory(w http.ResponseWriter, r *http.Request) {
+	products := s.worker.Ledger().Inventory
+	for _, direction := range s.worker.Directions() {
+		products[direction.Product] += 0
+	}
+	items := []InventoryItem{}
+	for _, product := range slices.Sorted(maps.Keys(products)) {
+		item, _ := s.inventoryItem(product)
+		items = append(items, item)
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// restV2InventoryItem returns the stock of a single product
+func (s *Server) restV2InventoryItem(w http.ResponseWriter, r *http.Request) {
+	item, ok := s.inventoryItem(r.PathValue("product"))
+	if !ok {
+		writeProblem(w, r, http.StatusNotFound, "", fmt.Sprintf("the worker neither has nor makes %q", r.PathValue("product")))
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// inventoryItem returns the stock of the product, false when the worker neither has nor makes it
+func (s *Server) inventoryItem(product string) (InventoryItem, bool) {
+	item := InventoryItem{Product: product}
+	item.Amount, item.Available = s.worker.Stock(product)
+	item.Price = s.worker.Prices()[product]
+	known := item.Amount > 0
+	for _, direction := range s.worker.Directions() {
+		if direction.Product == product {
+			item.Minimum = direction.Minimum
+			known = true
+		}
+	}
+	return item, known
+}
+
+// restV2Directions returns what the worker produces and buys
+func (s *Server) restV2Directions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.worker.Directions())
+}
+
+// restV2Orders lists the orders the worker remembers, oldest first
+func (s *Server) restV2Orders(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.worker.Orders())
+}
+
+// restV2CreateOrder sells the products of the order right away, or fails without taking anything.
+// A standing order is accepted into the order book instead when there is no stock for it yet.
+func (s *Server) restV2CreateOrder(w http.ResponseWriter, r *http.Request) {
+	// continue the trace of the buyer
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "Server.restV2CreateOrder", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	id, err := s.authorize(ctx, r)
+	if err != nil {
+		writeAuthHeader(w, err)
+		writeProblem(w, r, authStatus(err), "", err.Error())
+		return
+	}
+	var req OrderRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	var invalid []string
+	if req.Product == "" {
+		invalid = append(invalid, "product must not be empty")
+	}
+	if req.Quantity <= 0 {
+		invalid = append(invalid, fmt.Sprintf("quantity must be positive, got %d", req.Quantity))
+	}
+	if req.Payment < 0 {
+		invalid = append(invalid, fmt.Sprintf("payment must not be negative, got %d", req.Payment))
+	}
+	if !validCallback(req.Callback) {
+		invalid = append(invalid, fmt.Sprintf("callback must be an http url, got %q", req.Callback))
+	}
+	if len(invalid) > 0 {
+		writeProblem(w, r, http.StatusBadRequest, ProblemInvalidRequest, strings.Join(invalid, ", "))
+		return
+	}
+	span.SetAttributes(
+		attribute.String("civ.product", req.Product),
+		attribute.Int("civ.amount", req.Quantity),
+		attribute.Bool("civ.standing", req.Standing),
+	)
+
+	order, err := s.worker.PlaceOrder(ctx, req.Product, req.Quantity, req.Payment, req.Callback, id.Principal(), req.Standing)
+	switch {
+	case errors.Is(err, worker.ErrUnknownProduct):
+		writeProblem(w, r, http.StatusUnprocessableEntity, ProblemUnknownProduct,
+			fmt.Sprintf("the worker does not make %s", req.Product))
+		return
+	case errors.Is(err, worker.ErrNotEnoughInventory):
+		_, available := s.worker.Stock(req.Product)
+		writeProblem(w, r, http.StatusConflict, ProblemOutOfStock,
+			fmt.Sprintf("%d %s requested, %d available", req.Quantity, req.Product, available))
+		return
+	case errors.Is(err, worker.ErrInsufficientPayment):
+		writeProblem(w, r, http.StatusPaymentRequired, ProblemInsufficientPayment,
+			fmt.Sprintf("%d %s cost more than the %d coins paid", req.Quantity, req.Product, req.Payment))
+		return
+	case errors.Is(err, worker.ErrOrderTooLarge):
+		writeProblem(w, r, http.StatusBadRequest, ProblemInvalidRequest, err.Error())
+		return
+	case errors.Is(err, worker.ErrTooManyOrders):
+		writeProblem(w, r, http.StatusTooManyRequests, ProblemTooManyOrders, err.Error())
+		return
+	case err != nil:
+		writeProblem(w, r, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/api/v2/orders/"+order.ID)
+	if order.Status == worker.OrderPending {
+		writeJSON(w, http.StatusAccepted, order)
+		return
+	}
+	writeJSON(w, http.StatusCreated, order)
+}
+
+// restV2Order returns an order, pending or settled
+func (s *Server) restV2Order(w http.ResponseWriter, r *http.Request) {
+	order, err := s.worker.Order(r.PathValue("id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusNotFound, "", fmt.Sprintf("no order %q", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, order)
+}
+
+// restV2CancelOrder cancels a pending order, settled orders can't be cancelled
+func (s *Server) restV2CancelOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := s.authorize(r.Context(), r)
+	if err != nil {
+		writeAuthHeader(w, err)
+		writeProblem(w, r, authStatus(err), "", err.Error())
+		return
+	}
+	order, err := s.worker.CancelOrder(r.Context(), r.PathValue("id"), id.Principal())
+	switch {
+	case errors.Is(err, worker.ErrNotOrderOwner):
+		writeProblem(w, r, http.StatusForbidden, ProblemNotOrderOwner, "only the buyer that placed the order can cancel it")
+		return
+	case errors.Is(err, worker.ErrOrderNotFound):
+		writeProblem(w, r, http.StatusNotFound, "", fmt.Sprintf("no order %q", r.PathValue("id")))
+		return
+	case errors.Is(err, worker.ErrOrderSettled):
+		writeProblem(w, r, http.StatusConflict, ProblemOrderSettled, fmt.Sprintf("the order is already %s", order.Status))
+		return
+	case err != nil:
+		writeProblem(w, r, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, order)
+}
+
+// restV2Deliver is told by a store that a standing order of the worker is settled, through the callback of the order.
+// Only the ID of the posted order is used, the worker settles the order as it fetches it back from its store.
+func (s *Server) restV2Deliver(w http.ResponseWriter, r *http.Request) {
+	if err := s.authorizeWorker(r.Context(), r); err != nil {
+		writeAuthHeader(w, err)
+		writeProblem(w, r, authStatus(err), "", err.Error())
+		return
+	}
+	var order worker.Order
+	if !decodeJSON(w, r, &order) {
+		return
+	}
+	settled, err := s.worker.OrderSettled(r.Context(), order.ID)
+	switch {
+	case errors.Is(err, worker.ErrOrderNotFound):
+		writeProblem(w, r, http.StatusNotFound, "", fmt.Sprintf("the worker isn't waiting for order %q", order.ID))
+	case err != nil:
+		writeProblem(w, r, http.StatusInternalServerError, "", err.Error())
+	case !settled:
+		w.WriteHeader(http.StatusAccepted) // the store doesn't confirm it yet, the worker keeps polling
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// restV2OpenAPI serves the OpenAPI document of /api/v2
+func (s *Server) restV2OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPI)
+}
+
+// validCallback reports whether a callback is empty or an http url
+func validCallback(callback string) bool {
+	if callback == "" {
+		return true
+	}
+	u, err := url.Parse(callback)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// decodeJSON strictly decodes a json request body, writing a problem and returning false when it can't
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		writeProblem(w, r, http.StatusUnsupportedMediaType, "", "the body must be application/json")
+		return false
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, ProblemInvalidRequest, "invalid json body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeJSON responds with the value as json
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Debug("error encoding response", "error", err)
+	}
+}
+
+// writeProblem responds with a problem+json error. An empty problem type is about:blank.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, problemType, detail string) {
+	if problemType == "" {
+		problemType = "about:blank"
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	problem := Problem{
+		Type:     problemType,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	}
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		slog.Debug("error encoding problem", "error", err)
+	}
+}
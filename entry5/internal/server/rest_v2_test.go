@@ -0,0 +1,223 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// openAPIDocument is the part of openapi.json the tests check the routes against
+type openAPIDocument struct {
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+// operation is a documented method of a path, with its responses by status
+type operation struct {
+	Responses map[string]json.RawMessage `json:"responses"`
+}
+
+func loadOpenAPI(t *testing.T) openAPIDocument {
+	t.Helper()
+	var doc openAPIDocument
+	if err := json.Unmarshal(openAPI, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// documented returns whether the document lists the status as a response of the method on the path
+func (doc openAPIDocument) documented(t *testing.T, path, method string, status int) bool {
+	t.Helper()
+	raw, ok := doc.Paths[path][strings.ToLower(method)]
+	if !ok {
+		return false
+	}
+	var op operation
+	if err := json.Unmarshal(raw, &op); err != nil {
+		t.Fatal(err)
+	}
+	_, ok = op.Responses[strconv.Itoa(status)]
+	return ok
+}
+
+// do sends a request with a json body, empty for none, and returns the response with its body read
+func do(t *testing.T, method, url, body string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, data
+}
+
+func TestRESTv2(t *testing.T) {
+	srv, _ := newTestServer(t, 10)
+	doc := loadOpenAPI(t)
+
+	for _, tt := range []struct {
+		name    string
+		method  string
+		path    string // path is requested
+		route   string // route is the path in openapi.json, empty for requests no route takes
+		body    string
+		status  int
+		problem string // problem is the problem type of an error, empty for a success
+	}{
+		{"inventory", http.MethodGet, "/api/v2/inventory", "/api/v2/inventory", "", http.StatusOK, ""},
+		{"inventory item", http.MethodGet, "/api/v2/inventory/wood", "/api/v2/inventory/{product}", "", http.StatusOK, ""},
+		{"unknown inventory item", http.MethodGet, "/api/v2/inventory/iron", "/api/v2/inventory/{product}", "", http.StatusNotFound, "about:blank"},
+		{"directions", http.MethodGet, "/api/v2/directions", "/api/v2/directions", "", http.StatusOK, ""},
+		{"orders", http.MethodGet, "/api/v2/orders", "/api/v2/orders", "", http.StatusOK, ""},
+		{"order filled", http.MethodPost, "/api/v2/orders", "/api/v2/orders", `{"product":"wood","quantity":2,"payment":100}`, http.StatusCreated, ""},
+		{"invalid order", http.MethodPost, "/api/v2/orders", "/api/v2/orders", `{"product":"","quantity":0,"payment":-1}`, http.StatusBadRequest, ProblemInvalidRequest},
+		{"unknown field", http.MethodPost, "/api/v2/orders", "/api/v2/orders", `{"item":"wood"}`, http.StatusBadRequest, ProblemInvalidRequest},
+		{"too large order", http.MethodPost, "/api/v2/orders", "/api/v2/orders", `{"product":"wood","quantity":101,"payment":100000,"standing":true}`, http.StatusBadRequest, ProblemInvalidRequest},
+		{"unknown product", http.MethodPost, "/api/v2/orders", "/api/v2/orders", `{"product":"iron","quantity":1,"payment":100}`, http.StatusUnprocessableEntity, ProblemUnknownProduct},
+		{"out of stock", http.MethodPost, "/api/v2/orders", "/api/v2/orders", `{"product":"wood","quantity":1000,"payment":100000}`, http.StatusConflict, ProblemOutOfStock},
+		{"insufficient payment", http.MethodPost, "/api/v2/orders", "/api/v2/orders", `{"product":"wood","quantity":1,"payment":0}`, http.StatusPaymentRequired, ProblemInsufficientPayment},
+		// the standing order holds the stock back from the spot sales, so it comes after them
+		{"standing order", http.MethodPost, "/api/v2/orders", "/api/v2/orders", `{"product":"wood","quantity":50,"payment":10000,"standing":true}`, http.StatusAccepted, ""},
+		{"unknown order", http.MethodGet, "/api/v2/orders/ord_0", "/api/v2/orders/{id}", "", http.StatusNotFound, "about:blank"},
+		{"cancel unknown order", http.MethodDelete, "/api/v2/orders/ord_0", "/api/v2/orders/{id}", "", http.StatusNotFound, "about:blank"},
+		{"delivery of an unknown order", http.MethodPost, "/api/v2/deliveries", "/api/v2/deliveries", `{"id":"ord_0"}`, http.StatusNotFound, "about:blank"},
+		{"openapi", http.MethodGet, "/api/v2/openapi.json", "/api/v2/openapi.json", "", http.StatusOK, ""},
+		{"unknown resource", http.MethodGet, "/api/v2/nothing", "", "", http.StatusNotFound, "about:blank"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, tt.method, srv.URL+tt.path, tt.body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d: %s", resp.StatusCode, tt.status, body)
+			}
+			if tt.route != "" && !doc.documented(t, tt.route, tt.method, tt.status) {
+				t.Errorf("openapi.json doesn't document %d for %s %s", tt.status, tt.method, tt.route)
+			}
+			if tt.problem == "" {
+				if got := resp.Header.Get("Content-Type"); got != "application/json" {
+					t.Errorf("Content-Type %q, want application/json", got)
+				}
+				return
+			}
+			if got := resp.Header.Get("Content-Type"); got != "application/problem+json" {
+				t.Errorf("Content-Type %q, want application/problem+json", got)
+			}
+			var problem Problem
+			if err := json.Unmarshal(body, &problem); err != nil {
+				t.Fatal(err)
+			}
+			want := Problem{Type: tt.problem, Title: http.StatusText(tt.status), Status: tt.status, Detail: problem.Detail, Instance: tt.path}
+			if problem != want || problem.Detail == "" {
+				t.Errorf("problem %+v, want %+v with a detail", problem, want)
+			}
+		})
+	}
+}
+
+func TestRESTv2UnsupportedMediaType(t *testing.T) {
+	srv, _ := newTestServer(t, 10)
+	resp, err := http.Post(srv.URL+"/api/v2/orders", "text/plain", strings.NewReader(`{"product":"wood","quantity":1,"payment":100}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType || resp.Header.Get("Content-Type") != "application/problem+json" {
+		t.Errorf("status %d %s, want a 415 problem", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+// TestRESTv2Methods sends every method to every documented path: the documented ones are routed,
+// the others get 405 with the documented methods in Allow
+func TestRESTv2Methods(t *testing.T) {
+	srv, _ := newTestServer(t, 10)
+	doc := loadOpenAPI(t)
+	methods := []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+	for path, operations := range doc.Paths {
+		var allowed []string
+		for _, method := range methods {
+			if _, ok := operations[strings.ToLower(method)]; ok {
+				allowed = append(allowed, method)
+			}
+		}
+		if slices.Contains(allowed, http.MethodGet) {
+			allowed = append(allowed, http.MethodHead)
+		}
+		url := srv.URL + strings.NewReplacer("{product}", "wood", "{id}", "ord_0").Replace(path)
+
+		for _, method := range methods {
+			resp, body := do(t, method, url, "")
+			if slices.Contains(allowed, method) {
+				if resp.StatusCode == http.StatusMethodNotAllowed || strings.Contains(string(body), "no such resource") {
+					t.Errorf("%s %s: status %d, want it routed as openapi.json documents", method, path, resp.StatusCode)
+				}
+				continue
+			}
+			if resp.StatusCode != http.StatusMethodNotAllowed {
+				t.Errorf("%s %s: status %d, want 405", method, path, resp.StatusCode)
+				continue
+			}
+			if got := resp.Header.Get("Allow"); got != strings.Join(allowed, ", ") {
+				t.Errorf("%s %s: Allow %q, want %q", method, path, got, strings.Join(allowed, ", "))
+			}
+			if resp.Header.Get("Content-Type") != "application/problem+json" {
+				t.Errorf("%s %s: Content-Type %q, want a problem", method, path, resp.Header.Get("Content-Type"))
+			}
+		}
+	}
+}
+
+func TestRESTv2OrderLifecycle(t *testing.T) {
+	srv, _ := newTestServer(t, 0)
+	doc := loadOpenAPI(t)
+
+	resp, body := do(t, http.MethodPost, srv.URL+"/api/v2/orders", `{"product":"wood","quantity":5,"payment":1000,"standing":true}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", resp.StatusCode, body)
+	}
+	location := resp.Header.Get("Location")
+	resp, body = do(t, http.MethodGet, srv.URL+location, "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"status":"pending"`) {
+		t.Fatalf("GET %s: status %d %s, want the pending order", location, resp.StatusCode, body)
+	}
+
+	if resp, body = do(t, http.MethodDelete, srv.URL+location, ""); resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"status":"cancelled"`) {
+		t.Fatalf("DELETE %s: status %d %s, want the order cancelled", location, resp.StatusCode, body)
+	}
+	resp, body = do(t, http.MethodDelete, srv.URL+location, "")
+	var problem Problem
+	if err := json.Unmarshal(body, &problem); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusConflict || problem.Type != ProblemOrderSettled {
+		t.Errorf("second DELETE: status %d %+v, want a 409 order-settled problem", resp.StatusCode, problem)
+	}
+
+	// buyers without a token are told apart by their callback
+	for range 6 {
+		resp, body = do(t, http.MethodPost, srv.URL+"/api/v2/orders", `{"product":"wood","quantity":1,"payment":1000,"standing":true,"callback":"http://craftsman-0/api/v2/deliveries"}`)
+	}
+	if err := json.Unmarshal(body, &problem); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests || problem.Type != ProblemTooManyOrders {
+		t.Errorf("sixth pending order: status %d %+v, want a 429 too-many-orders problem", resp.StatusCode, problem)
+	}
+	if !doc.documented(t, "/api/v2/orders", http.MethodPost, http.StatusTooManyRequests) {
+		t.Error("openapi.json doesn't document 429 for POST /api/v2/orders")
+	}
+}
@@ -0,0 +1,257 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/clock"
+	"github.com/Potokar1/k8s-research/entry5/internal/server"
+	"github.com/Potokar1/k8s-research/entry5/internal/town"
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Epoch is the virtual time every simulation starts at
+var Epoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// defaultCoins are the coins of a worker whose shop doesn't set any, the same as the chart
+const defaultCoins = 1000
+
+// Simulation runs the shops of the chart values in-process, one worker for each replica.
+// Workers buy from each other through in-memory transports instead of cluster DNS,
+// nothing is saved to Kubernetes, and time is virtual.
+type Simulation struct {
+	clock    *clock.Virtual
+	workers  []*simWorker
+	services map[string][]*simWorker // services are the workers behind each kingdom/shop, like a Service
+	pods     map[string]*simWorker   // pods are the workers by kingdom/name, like the IP of a pod
+	next     map[string]int          // next is the replica each service sends its next request to
+	nextLock sync.Mutex              // nextLock guards next, gRPC connections are dialed outside of the workers
+}
+
+type simWorker struct {
+	kingdom  string
+	town     string
+	shop     string
+	name     string
+	worker   *worker.Worker
+	schedule worker.ScheduleOptions
+	handler  http.Handler
+	grpc     *grpc.Server
+	listener *bufconn.Listener // listener takes the gRPC connections of the other workers
+}
+
+// Sample is the ledger of every worker at one point of the simulation
+type Sample struct {
+	Time    time.Duration // Time is the virtual time since the start of the simulation
+	Workers []WorkerSample
+}
+
+// WorkerSample is the ledger of a single worker
+type WorkerSample struct {
+	Kingdom string        `json:"kingdom"`
+	Town    string        `json:"town"`
+	Shop    string        `json:"shop"`
+	Worker  string        `json:"worker"`
+	Ledger  worker.Ledger `json:"ledger"`
+}
+
+// New creates the workers of the kingdoms. An empty town name simulates every town of a kingdom.
+func New(kingdoms []town.Kingdom, townName string) (*Simulation, error) {
+	s := &Simulation{
+		clock:    clock.NewVirtual(Epoch),
+		services: make(map[string][]*simWorker),
+		pods:     make(map[string]*simWorker),
+		next:     make(map[string]int),
+	}
+	for _, kingdom := range kingdoms {
+		// inputs that discover their stores find the shops of the simulation
+		var shops []town.Shop
+		for _, t := range kingdom.Towns {
+			if townName == "" || t.Name == townName {
+				shops = append(shops, t.Shops...)
+			}
+		}
+		for _, t := range kingdom.Towns {
+			if townName != "" && t.Name != townName {
+				continue
+			}
+			for _, shop := range t.Shops {
+				coins := defaultCoins
+				if shop.Coins != nil {
+					coins = *shop.Coins
+				}
+				schedule, err := shop.Schedule()
+				if err != nil {
+					return nil, fmt.Errorf("%s/%s/%s: %w", kingdom.Name, t.Name, shop.Type, err)
+				}
+				for i := range shop.Replicas {
+					name := fmt.Sprintf("%s-%d", shop.Type, i)
+					w := worker.NewWorker(kingdom.Name, name, shop.Directions, coins, nil)
+					w.SetClock(s.clock)
+					w.SetHTTPClient(&http.Client{Transport: &transport{sim: s, kingdom: kingdom.Name}})
+					w.SetDiscovery(town.NewStaticDiscovery(shops, shop.Type))
+					w.SetCallbackURL(fmt.Sprintf("http://%s.%s.pod/api/v2/deliveries", name, kingdom.Name))
+
+					w.SetGRPCDialer(s.dial(kingdom.Name))
+
+					srv := server.NewServer(w)
+					mux := http.NewServeMux()
+					srv.InitializeREST(context.Background(), mux)
+					grpcSrv := grpc.NewServer()
+					srv.InitializeGRPC(grpcSrv)
+
+					sw := &simWorker{
+						kingdom:  kingdom.Name,
+						town:     t.Name,
+						shop:     shop.Type,
+						name:     name,
+						worker:   w,
+						schedule: schedule,
+						handler:  mux,
+						grpc:     grpcSrv,
+						listener: bufconn.Listen(1 << 20),
+					}
+					s.workers = append(s.workers, sw)
+					key := kingdom.Name + "/" + shop.Type
+					s.services[key] = append(s.services[key], sw)
+					s.pods[kingdom.Name+"/"+name] = sw
+				}
+			}
+		}
+	}
+	if len(s.workers) == 0 {
+		return nil, fmt.Errorf("no shops with replicas to simulate")
+	}
+	return s, nil
+}
+
+// Run runs the economy for the duration of virtual time, calling sample every interval, starting at zero.
+func (s *Simulation) Run(ctx context.Context, duration, interval time.Duration, sample func(Sample) error) error {
+	if interval <= 0 {
+		return fmt.Errorf("sample interval must be positive")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+		for _, sw := range s.workers {
+			sw.grpc.Stop()
+		}
+	}()
+
+	for _, sw := range s.workers {
+		go sw.grpc.Serve(sw.listener)
+	}
+	for _, sw := range s.workers {
+		s.clock.Go(&wg, func() { sw.worker.Work(ctx, sw.schedule) })
+	}
+
+	end := Epoch.Add(duration)
+	nextSample := Epoch
+	for ctx.Err() == nil {
+		deadline, ok := s.clock.Next()
+		if !ok || deadline.After(end) {
+			deadline = end
+		}
+		// every sample before the next deadline sees the economy at rest
+		for !nextSample.After(deadline) {
+			s.clock.Set(nextSample)
+			if err := sample(s.sample(nextSample.Sub(Epoch))); err != nil {
+				return err
+			}
+			nextSample = nextSample.Add(interval)
+		}
+		if !ok || deadline.Equal(end) && nextSample.After(end) {
+			return nil
+		}
+		s.clock.Wake()
+	}
+	return ctx.Err()
+}
+
+func (s *Simulation) sample(at time.Duration) Sample {
+	sample := Sample{Time: at}
+	for _, sw := range s.workers {
+		sample.Workers = append(sample.Workers, WorkerSample{
+			Kingdom: sw.kingdom,
+			Town:    sw.town,
+			Shop:    sw.shop,
+			Worker:  sw.name,
+			Ledger:  sw.worker.Ledger(),
+		})
+	}
+	return sample
+}
+
+// pick returns the replica of a shop that gets the next request, taking turns like a Service
+func (s *Simulation) pick(kingdom, shop string) *simWorker {
+	s.nextLock.Lock()
+	defer s.nextLock.Unlock()
+	key := kingdom + "/" + shop
+	replicas := s.services[key]
+	if len(replicas) == 0 {
+		return nil
+	}
+	sw := replicas[s.next[key]%len(replicas)]
+	s.next[key]++
+	return sw
+}
+
+// dial connects a worker of the kingdom to the gRPC server of a replica of the shop it names, such as ironworker:9090.
+// A connection stays with its replica, like an HTTP/2 connection through a Service.
+func (s *Simulation) dial(kingdom string) func(ctx context.Context, address string) (net.Conn, error) {
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		shop, rest, _ := strings.Cut(host, ".")
+		namespace, _, _ := strings.Cut(rest, ".")
+		if namespace == "" {
+			namespace = kingdom
+		}
+		sw := s.pick(namespace, shop)
+		if sw == nil {
+			return nil, fmt.Errorf("no shop %q in kingdom %q", shop, namespace)
+		}
+		return sw.listener.DialContext(ctx)
+	}
+}
+
+// transport sends the requests of a worker straight to the handler of the store it names.
+// http://woodworker goes to a woodworker in the same kingdom, http://woodworker.kingdom-of-foobar.svc to one in that kingdom,
+// and http://woodworker-0.kingdom-of-foobar.pod to that very worker, such as for the callbacks of orders.
+type transport struct {
+	sim     *Simulation
+	kingdom string
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	shop, rest, _ := strings.Cut(req.URL.Hostname(), ".")
+	kingdom := t.kingdom
+	if namespace, _, _ := strings.Cut(rest, "."); namespace != "" {
+		kingdom = namespace
+	}
+	var sw *simWorker
+	if strings.HasSuffix(rest, ".pod") {
+		sw = t.sim.pods[kingdom+"/"+shop]
+	} else {
+		sw = t.sim.pick(kingdom, shop)
+	}
+	if sw == nil {
+		return nil, fmt.Errorf("no shop %q in kingdom %q", shop, kingdom)
+	}
+
+	recorder := httptest.NewRecorder()
+	sw.handler.ServeHTTP(recorder, req)
+	return recorder.Result(), nil
+}
@@ -0,0 +1,54 @@
+package sim
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/town"
+)
+
+// run simulates the chart values and returns every sample
+func run(t *testing.T, kingdoms []town.Kingdom) []Sample {
+	t.Helper()
+	s, err := New(kingdoms, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var samples []Sample
+	err = s.Run(context.Background(), 30*time.Minute, time.Minute, func(sample Sample) error {
+		samples = append(samples, sample)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return samples
+}
+
+// TestRunDeterministic runs the same economy twice on the virtual clock, both runs must give the same time series
+func TestRunDeterministic(t *testing.T) {
+	kingdoms, err := town.ParseValuesFile("../../charts/civ/values.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := run(t, kingdoms)
+	second := run(t, kingdoms)
+	if len(first) != 31 {
+		t.Fatalf("got %d samples, want one a minute for 30m and the start", len(first))
+	}
+	traded := false
+	for i := range first {
+		if !reflect.DeepEqual(first[i], second[i]) {
+			t.Fatalf("sample at %s differs:\n%+v\n%+v", first[i].Time, first[i].Workers, second[i].Workers)
+		}
+		for _, w := range first[i].Workers {
+			traded = traded || len(w.Ledger.Inventory) > 0
+		}
+	}
+	if !traded {
+		t.Error("no worker ever had stock, the economy did not run")
+	}
+}
@@ -0,0 +1,66 @@
+package town
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+)
+
+// LoadFromCluster reads the shops of a town from the <shop>-directions ConfigMaps in the kingdom.
+// An empty town returns the shops of every town in the kingdom.
+func LoadFromCluster(ctx context.Context, client *k8s.Client, kingdom, town string) ([]Shop, error) {
+	shops, err := loadDirections(ctx, client, kingdom, town)
+	if err != nil {
+		return nil, err
+	}
+	replicas, err := client.ShopReplicas(ctx, kingdom, town)
+	if err != nil {
+		return nil, err
+	}
+	for i := range shops {
+		shops[i].Replicas = int(replicas[shops[i].Type])
+	}
+	return shops, nil
+}
+
+// loadDirections reads the directions of the shops from their ConfigMaps, without the replicas
+func loadDirections(ctx context.Context, client *k8s.Client, kingdom, town string) ([]Shop, error) {
+	selector := k8s.ShopLabel
+	if town != "" {
+		selector += "," + k8s.TownLabel + "=" + town
+	}
+	configMaps, err := client.ListConfigMaps(ctx, kingdom, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var shops []Shop
+	for _, cm := range configMaps {
+		if !strings.HasSuffix(cm.Name, "-directions") {
+			continue // other shop ConfigMaps, such as the inventory store
+		}
+		directions, err := worker.ParseDirections([]byte(cm.Data["directions.json"]))
+		if err != nil {
+			return nil, fmt.Errorf("configmap %s: %w", cm.Name, err)
+		}
+		shops = append(shops, Shop{
+			Type:       cm.Labels[k8s.ShopLabel],
+			Directions: directions,
+		})
+	}
+	slices.SortFunc(shops, func(a, b Shop) int { return strings.Compare(a.Type, b.Type) })
+	return shops, nil
+}
+
+// Services returns the names of the services the shops of a values file create, one for each shop
+func Services(shops []Shop) []string {
+	services := make([]string, 0, len(shops))
+	for _, shop := range shops {
+		services = append(services, shop.Type)
+	}
+	return services
+}
@@ -0,0 +1,89 @@
+package town
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
+)
+
+// discoveryTTL is how long the cluster discovery keeps the shops before reading them again
+const discoveryTTL = 30 * time.Second
+
+// Discovery finds the shops of a kingdom that make a product, for the worker inputs with discover set.
+// Every shop has a service named after it, so the stores are http://<shop>.
+type Discovery struct {
+	self string // self is the shop of the worker, which never buys from itself
+	load func(ctx context.Context) ([]Shop, error)
+	ttl  time.Duration
+
+	lock   sync.Mutex
+	shops  []Shop
+	loaded time.Time
+}
+
+// NewClusterDiscovery finds the shops from their directions ConfigMaps in the kingdom, read again every 30s
+func NewClusterDiscovery(client *k8s.Client, kingdom, self string) *Discovery {
+	return &Discovery{
+		self: self,
+		load: func(ctx context.Context) ([]Shop, error) {
+			return loadDirections(ctx, client, kingdom, "")
+		},
+		ttl: discoveryTTL,
+	}
+}
+
+// NewStaticDiscovery finds the stores among the shops, such as the shops of a values file
+func NewStaticDiscovery(shops []Shop, self string) *Discovery {
+	return &Discovery{
+		self:   self,
+		shops:  shops,
+		loaded: time.Now(),
+	}
+}
+
+// Stores returns the stores of every other shop that makes the product, sorted by name
+func (d *Discovery) Stores(ctx context.Context, product string) ([]string, error) {
+	shops, err := d.cached(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var stores []string
+	for _, shop := range shops {
+		if shop.Type == d.self {
+			continue
+		}
+		for _, direction := range shop.Directions {
+			if direction.Product == product {
+				stores = append(stores, "http://"+shop.Type)
+				break
+			}
+		}
+	}
+	slices.Sort(stores)
+	return stores, nil
+}
+
+// cached returns the shops, reading them again when they are older than the ttl.
+// The last shops read are kept when reading them again fails.
+func (d *Discovery) cached(ctx context.Context) ([]Shop, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.load == nil || time.Since(d.loaded) < d.ttl {
+		return d.shops, nil
+	}
+	shops, err := d.load(ctx)
+	if err != nil {
+		if d.shops != nil {
+			slog.WarnContext(ctx, "failed to discover shops, using the last ones found", "error", err)
+			return d.shops, nil
+		}
+		return nil, err
+	}
+	d.shops = shops
+	d.loaded = time.Now()
+	return shops, nil
+}
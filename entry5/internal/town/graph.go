@@ -0,0 +1,222 @@
+package town
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Edge is a consumer shop buying a product from a store
+type Edge struct {
+	Consumer string // Consumer is the shop buying the product
+	Store    string // Store is the service the product is bought from
+	Product  string // Product is the name of the product bought
+	Amount   int    // Amount is the quantity bought for each production
+}
+
+// Graph is the producer/consumer graph of a town
+type Graph struct {
+	Shops     []string            // Shops are the names of every shop, sorted
+	Produces  map[string][]string // Produces maps a shop to the products it makes
+	Producers map[string][]string // Producers maps a product to the shops that make it
+	Needs     map[string][]string // Needs maps a shop to the products it buys, whether or not it has a store for them
+	Edges     []Edge
+	Services  map[string]bool // Services are the names of the services shops can buy from
+}
+
+// Issue is a problem found in a graph
+type Issue struct {
+	Kind    string // Kind is a short, stable name of the problem
+	Message string
+}
+
+func (i Issue) String() string {
+	return i.Kind + ": " + i.Message
+}
+
+const (
+	IssueCycle           = "cycle"
+	IssueMissingProducer = "missing-producer"
+	IssueMissingService  = "missing-service"
+	IssueWrongStore      = "wrong-store"
+)
+
+// NewGraph builds the graph of the shops.
+// The services are the names of the services in the kingdom, usually one for each shop.
+func NewGraph(shops []Shop, services []string) *Graph {
+	g := &Graph{
+		Produces:  make(map[string][]string),
+		Producers: make(map[string][]string),
+		Needs:     make(map[string][]string),
+		Services:  make(map[string]bool, len(services)),
+	}
+	for _, service := range services {
+		g.Services[service] = true
+	}
+
+	for _, shop := range shops {
+		g.Shops = append(g.Shops, shop.Type)
+		for _, direction := range shop.Directions {
+			g.Produces[shop.Type] = append(g.Produces[shop.Type], direction.Product)
+			g.Producers[direction.Product] = append(g.Producers[direction.Product], shop.Type)
+		}
+	}
+	// an input has an edge to every store it can buy from, discovered stores included
+	for _, shop := range shops {
+		for _, direction := range shop.Directions {
+			for _, input := range direction.ProductInputList {
+				if !slices.Contains(g.Needs[shop.Type], input.Product) {
+					g.Needs[shop.Type] = append(g.Needs[shop.Type], input.Product)
+				}
+				var stores []string
+				for _, store := range append([]string{input.Store}, input.Stores...) {
+					if store != "" && !slices.Contains(stores, StoreService(store)) {
+						stores = append(stores, StoreService(store))
+					}
+				}
+				if input.Discover {
+					for _, producer := range g.Producers[input.Product] {
+						if producer != shop.Type && !slices.Contains(stores, producer) {
+							stores = append(stores, producer)
+						}
+					}
+				}
+				for _, store := range stores {
+					g.Edges = append(g.Edges, Edge{
+						Consumer: shop.Type,
+						Store:    store,
+						Product:  input.Product,
+						Amount:   input.Amount,
+					})
+				}
+			}
+		}
+	}
+	slices.Sort(g.Shops)
+	return g
+}
+
+// StoreService returns the name of the service a store URL points at.
+// http://woodworker, http://woodworker:80 and http://woodworker.kingdom-of-foobar.svc all point at woodworker.
+func StoreService(store string) string {
+	u, err := url.Parse(store)
+	if err != nil || u.Hostname() == "" {
+		return store
+	}
+	service, _, _ := strings.Cut(u.Hostname(), ".")
+	return service
+}
+
+// Analyze returns every problem in the graph, sorted by kind
+func (g *Graph) Analyze() []Issue {
+	var issues []Issue
+	// an input nobody produces may have no edge at all, such as one that only discovers its stores
+	for _, shop := range g.Shops {
+		for _, product := range g.Needs[shop] {
+			if len(g.Producers[product]) == 0 {
+				issues = append(issues, Issue{IssueMissingProducer, fmt.Sprintf("%s needs %s but no shop produces it", shop, product)})
+			}
+		}
+	}
+	for _, edge := range g.Edges {
+		if !g.Services[edge.Store] {
+			issues = append(issues, Issue{IssueMissingService, fmt.Sprintf("%s buys %s from %s but there is no such service", edge.Consumer, edge.Product, edge.Store)})
+		} else if !slices.Contains(g.Produces[edge.Store], edge.Product) {
+			issues = append(issues, Issue{IssueWrongStore, fmt.Sprintf("%s buys %s from %s but %s does not produce it", edge.Consumer, edge.Product, edge.Store, edge.Store)})
+		}
+	}
+	for _, cycle := range g.Cycles() {
+		issues = append(issues, Issue{IssueCycle, strings.Join(cycle, " → ")})
+	}
+	slices.SortStableFunc(issues, func(a, b Issue) int { return strings.Compare(a.Kind, b.Kind) })
+	return issues
+}
+
+// Cycles returns every cycle of shops buying from each other, each starting and ending with the same shop.
+// A cycle means no shop in it can produce before another shop in it already has.
+func (g *Graph) Cycles() [][]string {
+	suppliers := make(map[string][]string)
+	for _, edge := range g.Edges {
+		if !slices.Contains(suppliers[edge.Consumer], edge.Store) {
+			suppliers[edge.Consumer] = append(suppliers[edge.Consumer], edge.Store)
+		}
+	}
+	for _, s := range suppliers {
+		slices.Sort(s)
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var stack []string
+	var cycles [][]string
+
+	var visit func(shop string)
+	visit = func(shop string) {
+		state[shop] = visiting
+		stack = append(stack, shop)
+		for _, supplier := range suppliers[shop] {
+			switch state[supplier] {
+			case unvisited:
+				visit(supplier)
+			case visiting:
+				// the supplier is on the stack, everything after it is a cycle
+				start := slices.Index(stack, supplier)
+				cycle := append(slices.Clone(stack[start:]), supplier)
+				cycles = append(cycles, cycle)
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[shop] = visited
+	}
+	for _, shop := range g.Shops {
+		if state[shop] == unvisited {
+			visit(shop)
+		}
+	}
+	return cycles
+}
+
+// DOT renders the graph in the graphviz dot language. Edges point from the store to the consumer.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph town {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, shop := range g.Shops {
+		fmt.Fprintf(&b, "  %q [label=%q];\n", shop, shop+"\n"+strings.Join(g.Produces[shop], ", "))
+	}
+	for _, edge := range g.Edges {
+		attrs := fmt.Sprintf("label=%q", fmt.Sprintf("%d %s", edge.Amount, edge.Product))
+		if !g.Services[edge.Store] {
+			attrs += ", style=dashed, color=red"
+		}
+		fmt.Fprintf(&b, "  %q -> %q [%s];\n", edge.Store, edge.Consumer, attrs)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the graph as a mermaid flowchart. Edges point from the store to the consumer.
+func (g *Graph) Mermaid() string {
+	id := func(shop string) string {
+		return strings.NewReplacer("-", "_", ".", "_", ":", "_", "/", "_").Replace(shop)
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, shop := range g.Shops {
+		fmt.Fprintf(&b, "  %s[\"%s<br/>%s\"]\n", id(shop), shop, strings.Join(g.Produces[shop], ", "))
+	}
+	for _, edge := range g.Edges {
+		arrow := "-->"
+		if !g.Services[edge.Store] {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s|%d %s| %s\n", id(edge.Store), arrow, edge.Amount, edge.Product, id(edge.Consumer))
+	}
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package town
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+)
+
+func TestAnalyzeMissingProducer(t *testing.T) {
+	shops := []Shop{
+		{Type: "woodworker", Directions: []worker.Direction{{Product: "wood", Amount: 1, Interval: 1}}},
+		{Type: "craftsman", Directions: []worker.Direction{{Product: "chair", Amount: 1, Interval: 1, ProductInputList: []worker.ProductInput{
+			{Product: "wood", Amount: 2, Store: "http://woodworker"},
+			{Product: "unobtainium", Amount: 1, Discover: true},
+		}}}},
+	}
+	g := NewGraph(shops, []string{"woodworker", "craftsman"})
+
+	want := []Issue{{IssueMissingProducer, "craftsman needs unobtainium but no shop produces it"}}
+	if issues := g.Analyze(); !reflect.DeepEqual(issues, want) {
+		t.Errorf("issues = %v, want %v", issues, want)
+	}
+	if len(g.Edges) != 1 || g.Edges[0].Product != "wood" {
+		t.Errorf("edges = %+v, want only the one for wood", g.Edges)
+	}
+}
+
+func TestAnalyzeMissingProducerOnce(t *testing.T) {
+	// a listed store and a discovered one for the same input report the missing producer once
+	shops := []Shop{
+		{Type: "craftsman", Directions: []worker.Direction{{Product: "chair", Amount: 1, Interval: 1, ProductInputList: []worker.ProductInput{
+			{Product: "wood", Amount: 2, Store: "http://woodworker", Discover: true},
+		}}}},
+	}
+	issues := NewGraph(shops, []string{"craftsman"}).Analyze()
+	want := []Issue{
+		{IssueMissingProducer, "craftsman needs wood but no shop produces it"},
+		{IssueMissingService, "craftsman buys wood from woodworker but there is no such service"},
+	}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("issues = %v, want %v", issues, want)
+	}
+}
@@ -0,0 +1,270 @@
+package town
+
+import (
+	"math"
+	"slices"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+)
+
+// ShopPlan is the steady state of a single shop
+type ShopPlan struct {
+	Shop        string
+	Replicas    int                // Replicas is the current number of workers
+	Recommended int                // Recommended is the number of workers that keeps every consumer fed
+	Production  map[string]float64 // Production is the units per second of each product at the current replicas, as far as its inputs are supplied
+	Consumption map[string]float64 // Consumption is the units per second of each input at the current replicas, as far as they are supplied
+	Utilization float64            // Utilization is the demand for the shop's products divided by its production with every input supplied
+}
+
+// ProductFlow is the steady state of a single product across the town
+type ProductFlow struct {
+	Supply float64 // Supply is the units per second produced by every producer, as far as their inputs are supplied
+	Demand float64 // Demand is the units per second every consumer would consume at full capacity
+}
+
+// Plan is the steady state throughput of a town
+type Plan struct {
+	Shops      []ShopPlan
+	Products   map[string]ProductFlow
+	Unsupplied []string // Unsupplied are the inputs with no supply at all, no shop makes them or their shops have no replicas
+	Bottleneck string   // Bottleneck is the first unsupplied input, else the shop with the highest utilization, empty if no shop is over capacity
+}
+
+// rates is the production and consumption of a single worker, in units per second
+type rates struct {
+	production  map[string]float64
+	consumption map[string]float64
+	runs        []float64 // runs are the productions per second of each direction
+}
+
+// workerRates models Worker.Work: every direction runs on its own schedule, a job every interval plus the labor time.
+// A job either buys one missing input or produces, so a direction with n inputs needs n+1 jobs to produce once
+// when the worker starts without stock. When the jobs need more than the capacity slots, every direction slows down alike.
+func workerRates(shop Shop) rates {
+	r := rates{
+		production:  make(map[string]float64),
+		consumption: make(map[string]float64),
+	}
+	schedule, err := shop.Schedule()
+	if err != nil {
+		schedule = worker.ScheduleOptions{} // the values are validated when read, a bad schedule here runs on the defaults
+	}
+	laborTime := worker.DefaultLaborTime.Seconds()
+	if schedule.LaborTime > 0 {
+		laborTime = schedule.LaborTime.Seconds()
+	}
+	capacity := schedule.Capacity
+	if capacity <= 0 || capacity > len(shop.Directions) {
+		capacity = len(shop.Directions)
+	}
+
+	// jobs is the number of jobs per second every direction asks for, a slot runs 1/laborTime of them
+	jobs := 0.0
+	for _, direction := range shop.Directions {
+		jobs += 1 / (float64(direction.Interval) + laborTime)
+	}
+	slowdown := 1.0
+	if limit := float64(capacity) / laborTime; jobs > limit {
+		slowdown = limit / jobs
+	}
+
+	for _, direction := range shop.Directions {
+		productions := slowdown / ((float64(direction.Interval) + laborTime) * float64(len(direction.ProductInputList)+1))
+		r.runs = append(r.runs, productions)
+		r.production[direction.Product] += float64(direction.Amount) * productions
+		for _, input := range direction.ProductInputList {
+			r.consumption[input.Product] += float64(input.Amount) * productions
+		}
+	}
+	return r
+}
+
+// supplied returns the rates of a worker whose directions run at the shares of their full rate
+func (r rates) supplied(shop Shop, shares []float64) rates {
+	s := rates{
+		production:  make(map[string]float64),
+		consumption: make(map[string]float64),
+	}
+	for i, direction := range shop.Directions {
+		productions := r.runs[i] * shares[i]
+		s.runs = append(s.runs, productions)
+		s.production[direction.Product] += float64(direction.Amount) * productions
+		for _, input := range direction.ProductInputList {
+			s.consumption[input.Product] += float64(input.Amount) * productions
+		}
+	}
+	return s
+}
+
+// supplyShares caps every direction by the supply of its inputs at the replicas. The consumers of an input share its supply
+// in proportion to their demand at full capacity, and a direction runs at the share of its scarcest input: not at all without supply.
+// It returns the share of its full rate each direction of each shop runs at.
+func supplyShares(shops []Shop, perWorker map[string]rates, replicas map[string]int) map[string][]float64 {
+	shares := make(map[string][]float64, len(shops))
+	for _, shop := range shops {
+		shares[shop.Type] = slices.Repeat([]float64{1}, len(shop.Directions))
+	}
+	demand := flows(shops, perWorker, replicas)
+	// a short supply reaches one more shop down the graph every round, shares only ever go down
+	for range len(shops) + 1 {
+		supply := make(map[string]float64)
+		for _, shop := range shops {
+			for i, direction := range shop.Directions {
+				supply[direction.Product] += float64(direction.Amount) * perWorker[shop.Type].runs[i] * shares[shop.Type][i] * float64(replicas[shop.Type])
+			}
+		}
+		changed := false
+		for _, shop := range shops {
+			for i, direction := range shop.Directions {
+				share := 1.0
+				for _, input := range direction.ProductInputList {
+					if want := demand[input.Product].Demand; want > 0 {
+						share = min(share, supply[input.Product]/want)
+					}
+				}
+				if share != shares[shop.Type][i] {
+					shares[shop.Type][i] = share
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return shares
+}
+
+// NewPlan computes the steady state of the shops and the replicas each shop needs
+// so that no consumer is starved, assuming every consumer works at full capacity.
+func NewPlan(shops []Shop) *Plan {
+	perWorker := make(map[string]rates, len(shops))
+	replicas := make(map[string]int, len(shops))
+	for _, shop := range shops {
+		perWorker[shop.Type] = workerRates(shop)
+		replicas[shop.Type] = shop.Replicas
+	}
+
+	// the utilization and the recommended replicas are sized for full capacity, the rates shown are capped by the inputs on hand
+	potential := flows(shops, perWorker, replicas)
+	shares := supplyShares(shops, perWorker, replicas)
+	actual := make(map[string]rates, len(shops))
+	for _, shop := range shops {
+		actual[shop.Type] = perWorker[shop.Type].supplied(shop, shares[shop.Type])
+	}
+	plan := &Plan{
+		Products: flows(shops, actual, replicas),
+	}
+	for product, flow := range potential {
+		if flow.Demand > 0 && flow.Supply == 0 {
+			plan.Unsupplied = append(plan.Unsupplied, product)
+		}
+		// demand is what the consumers ask for at full capacity, whether or not they get their own inputs
+		supplied := plan.Products[product]
+		supplied.Demand = flow.Demand
+		plan.Products[product] = supplied
+	}
+	slices.Sort(plan.Unsupplied)
+
+	// grow the producers until supply meets demand. Consumers are sized before their producers
+	// because scaling a producer raises the demand for its own inputs, so repeat until nothing changes.
+	recommended := make(map[string]int, len(shops))
+	for _, shop := range shops {
+		recommended[shop.Type] = max(shop.Replicas, 1)
+	}
+	for range len(shops) + 1 {
+		changed := false
+		products := flows(shops, perWorker, recommended)
+		for _, shop := range shops {
+			need := 1
+			consumed := false
+			for product := range perWorker[shop.Type].production {
+				flow := products[product]
+				if flow.Demand == 0 {
+					continue
+				}
+				consumed = true
+				// every producer of the product is scaled by the same factor
+				need = max(need, int(math.Ceil(float64(recommended[shop.Type])*flow.Demand/flow.Supply-1e-9)))
+			}
+			if !consumed {
+				need = max(shop.Replicas, 1) // nobody buys from this shop, keep it as it is
+			}
+			if need != recommended[shop.Type] {
+				recommended[shop.Type] = need
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	highest := 1.0
+	for _, shop := range shops {
+		r := perWorker[shop.Type]
+		sp := ShopPlan{
+			Shop:        shop.Type,
+			Replicas:    shop.Replicas,
+			Recommended: recommended[shop.Type],
+			Production:  scale(actual[shop.Type].production, shop.Replicas),
+			Consumption: scale(actual[shop.Type].consumption, shop.Replicas),
+		}
+		for product := range r.production {
+			flow := potential[product]
+			if flow.Supply > 0 {
+				sp.Utilization = max(sp.Utilization, flow.Demand/flow.Supply)
+			} else if flow.Demand > 0 {
+				sp.Utilization = math.Inf(1)
+			}
+		}
+		if sp.Utilization > highest {
+			highest = sp.Utilization
+			plan.Bottleneck = sp.Shop
+		}
+		plan.Shops = append(plan.Shops, sp)
+	}
+	if len(plan.Unsupplied) > 0 {
+		// nothing downstream of an input without supply runs, whatever the utilization of the other shops
+		plan.Bottleneck = plan.Unsupplied[0]
+	}
+	slices.SortFunc(plan.Shops, func(a, b ShopPlan) int {
+		if a.Shop < b.Shop {
+			return -1
+		}
+		if a.Shop > b.Shop {
+			return 1
+		}
+		return 0
+	})
+	return plan
+}
+
+// flows sums the supply and demand of every product for the given replicas
+func flows(shops []Shop, perWorker map[string]rates, replicas map[string]int) map[string]ProductFlow {
+	products := make(map[string]ProductFlow)
+	for _, shop := range shops {
+		r := perWorker[shop.Type]
+		n := float64(replicas[shop.Type])
+		for product, rate := range r.production {
+			flow := products[product]
+			flow.Supply += rate * n
+			products[product] = flow
+		}
+		for product, rate := range r.consumption {
+			flow := products[product]
+			flow.Demand += rate * n
+			products[product] = flow
+		}
+	}
+	return products
+}
+
+func scale(perWorker map[string]float64, replicas int) map[string]float64 {
+	scaled := make(map[string]float64, len(perWorker))
+	for product, rate := range perWorker {
+		scaled[product] = rate * float64(replicas)
+	}
+	return scaled
+}
@@ -0,0 +1,72 @@
+package town
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+)
+
+// smithy is a woodworker and a craftsman making axes from wood and the input, with the replicas of the woodworker
+func smithy(input string, woodworkers int) []Shop {
+	return []Shop{
+		{Type: "woodworker", Replicas: woodworkers, Directions: []worker.Direction{{Product: "wood", Amount: 10, Interval: 1}}},
+		{Type: "craftsman", Replicas: 1, Directions: []worker.Direction{{Product: "axe", Amount: 1, Interval: 3, ProductInputList: []worker.ProductInput{
+			{Product: "wood", Amount: 1, Store: "http://woodworker"},
+			{Product: input, Amount: 1, Discover: true},
+		}}}},
+	}
+}
+
+func shopPlan(t *testing.T, plan *Plan, shop string) ShopPlan {
+	t.Helper()
+	i := slices.IndexFunc(plan.Shops, func(sp ShopPlan) bool { return sp.Shop == shop })
+	if i < 0 {
+		t.Fatalf("no plan for %s", shop)
+	}
+	return plan.Shops[i]
+}
+
+func TestPlanUnsuppliedInput(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		shops []Shop
+		want  string
+	}{
+		{"no producer", smithy("unobtainium", 1), "unobtainium"},
+		{"producer without replicas", smithy("wood", 0), "wood"},
+	} {
+		plan := NewPlan(tt.shops)
+		craftsman := shopPlan(t, plan, "craftsman")
+		if craftsman.Production["axe"] != 0 || plan.Products["axe"].Supply != 0 {
+			t.Errorf("%s: axes = %v/s, want none without %s", tt.name, craftsman.Production["axe"], tt.want)
+		}
+		if craftsman.Consumption["wood"] != 0 {
+			t.Errorf("%s: wood consumed = %v/s, want none while the axe can't be made", tt.name, craftsman.Consumption["wood"])
+		}
+		if plan.Bottleneck != tt.want || !slices.Equal(plan.Unsupplied, []string{tt.want}) {
+			t.Errorf("%s: bottleneck %q, unsupplied %v, want %s", tt.name, plan.Bottleneck, plan.Unsupplied, tt.want)
+		}
+		if plan.Products[tt.want].Demand == 0 {
+			t.Errorf("%s: demand for %s = 0, want the demand of the craftsman at full capacity", tt.name, tt.want)
+		}
+	}
+}
+
+func TestPlanCapsBySupply(t *testing.T) {
+	// the woodworker makes 10 wood every 2s, a craftsman wants 1 wood every 4s: 40 of them get half of what they want
+	shops := smithy("wood", 1)
+	shops[1].Replicas = 40
+	shops[1].Directions[0].ProductInputList = shops[1].Directions[0].ProductInputList[:1]
+	shops[1].Directions[0].Interval = 1
+
+	plan := NewPlan(shops)
+	full := 40 * 1.0 / (2 * 2)
+	if got := shopPlan(t, plan, "craftsman").Production["axe"]; math.Abs(got-full/2) > 1e-9 {
+		t.Errorf("axes = %v/s, want half of %v/s with half the wood supplied", got, full)
+	}
+	if plan.Bottleneck != "woodworker" || len(plan.Unsupplied) != 0 {
+		t.Errorf("bottleneck %q, unsupplied %v, want the woodworker", plan.Bottleneck, plan.Unsupplied)
+	}
+}
@@ -0,0 +1,122 @@
+package town
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+	"sigs.k8s.io/yaml"
+)
+
+// Kingdom is a kingdom from the helm chart values
+type Kingdom struct {
+	Name  string `json:"name"`
+	Towns []Town `json:"towns"`
+}
+
+// Town is a town from the helm chart values
+type Town struct {
+	Name  string `json:"name"`
+	Shops []Shop `json:"shops"`
+}
+
+// Shop is a shop from the helm chart values.
+// The type is also the name of the shop's Deployment, Service and directions ConfigMap.
+type Shop struct {
+	Type       string             `json:"type"`
+	Replicas   int                `json:"replicas"`
+	Coins      *int               `json:"coins,omitempty"`
+	Directions []worker.Direction `json:"directions"`
+
+	Capacity    int    `json:"capacity,omitempty"`    // Capacity is the number of jobs a worker runs at once, 0 for every direction at once
+	LaborTime   string `json:"laborTime,omitempty"`   // LaborTime is how long a job keeps a worker busy, such as 1s
+	InputPolicy string `json:"inputPolicy,omitempty"` // InputPolicy decides which direction gets a shared input: first-come or priority
+
+	AllowKingdoms []string `json:"allowKingdoms,omitempty"` // AllowKingdoms are the kingdoms whose shops may buy, empty for every kingdom
+	AllowShops    []string `json:"allowShops,omitempty"`    // AllowShops are the shops that may buy, empty for every shop
+}
+
+// Schedule returns how the workers of the shop run their directions
+func (s Shop) Schedule() (worker.ScheduleOptions, error) {
+	opts := worker.ScheduleOptions{Capacity: s.Capacity, LaborTime: worker.DefaultLaborTime}
+	if s.Capacity < 0 {
+		return opts, fmt.Errorf("capacity must not be negative, got %d", s.Capacity)
+	}
+	if s.LaborTime != "" {
+		laborTime, err := time.ParseDuration(s.LaborTime)
+		if err != nil {
+			return opts, fmt.Errorf("invalid labor time: %w", err)
+		}
+		if laborTime <= 0 {
+			return opts, fmt.Errorf("labor time must be positive, got %s", s.LaborTime)
+		}
+		opts.LaborTime = laborTime
+	}
+	policy, err := worker.ParseInputPolicy(s.InputPolicy)
+	if err != nil {
+		return opts, err
+	}
+	opts.InputPolicy = policy
+	return opts, nil
+}
+
+// values is the part of the chart values that describes the kingdoms
+type values struct {
+	Kingdoms []Kingdom `json:"kingdoms"`
+}
+
+// ParseValuesFile reads the kingdoms, towns and shops from a helm chart values file.
+// The directions of every shop get the same validation as a worker runs on startup.
+func ParseValuesFile(filename string) ([]Kingdom, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading values file: %w", err)
+	}
+
+	var v values
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("error unmarshalling values file: %w", err)
+	}
+
+	var errs []error
+	for _, kingdom := range v.Kingdoms {
+		for _, town := range kingdom.Towns {
+			for _, shop := range town.Shops {
+				if err := worker.ValidateDirections(shop.Directions); err != nil {
+					errs = append(errs, fmt.Errorf("%s/%s/%s: %w", kingdom.Name, town.Name, shop.Type, err))
+				}
+				if _, err := shop.Schedule(); err != nil {
+					errs = append(errs, fmt.Errorf("%s/%s/%s: %w", kingdom.Name, town.Name, shop.Type, err))
+				}
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid shops in values file: %w", err)
+	}
+	return v.Kingdoms, nil
+}
+
+// FindTown returns the shops of a town in a kingdom. An empty town name returns every shop of the kingdom.
+func FindTown(kingdoms []Kingdom, kingdomName, townName string) ([]Shop, error) {
+	for _, kingdom := range kingdoms {
+		if kingdom.Name != kingdomName {
+			continue
+		}
+		var shops []Shop
+		found := false
+		for _, town := range kingdom.Towns {
+			if townName == "" || town.Name == townName {
+				found = true
+				shops = append(shops, town.Shops...)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("town %q not found in kingdom %q", townName, kingdomName)
+		}
+		return shops, nil
+	}
+	return nil, fmt.Errorf("kingdom %q not found", kingdomName)
+}
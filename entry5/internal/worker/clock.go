@@ -0,0 +1,19 @@
+package worker
+
+import (
+	"net/http"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/clock"
+)
+
+// SetClock makes the worker produce, rest and price on the clock,
+// such as a scaled clock to run a town faster or a virtual one in a simulation
+func (w *Worker) SetClock(c clock.Clock) {
+	w.clock = c
+	w.pricing.now = c.Now
+}
+
+// SetHTTPClient makes the worker buy through the client, such as one with an in-memory transport
+func (w *Worker) SetHTTPClient(client *http.Client) {
+	w.client = client
+}
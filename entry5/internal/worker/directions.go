@@ -0,0 +1,111 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+)
+
+// ParseDirectionsFile reads a json file and returns a slice of validated Directions
+func ParseDirectionsFile(filename string) ([]Direction, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading worker directions file: %w", err)
+	}
+	return ParseDirections(data)
+}
+
+// ParseDirections strictly decodes json into a slice of Directions and validates them.
+// Unknown fields are errors, so a typo in a field name is never silently dropped.
+func ParseDirections(data []byte) ([]Direction, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var directions []Direction
+	if err := decoder.Decode(&directions); err != nil {
+		return nil, fmt.Errorf("error unmarshalling worker directions: %w", err)
+	}
+	// only a single json document is allowed
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error unmarshalling worker directions: unexpected data after the directions")
+	}
+
+	if err := ValidateDirections(directions); err != nil {
+		return nil, fmt.Errorf("invalid worker directions: %w", err)
+	}
+	return directions, nil
+}
+
+// ValidateDirections runs the semantic checks the json schema can't express on its own.
+// Every problem found is returned, not only the first.
+func ValidateDirections(directions []Direction) error {
+	var errs []error
+	for i, direction := range directions {
+		path := fmt.Sprintf("directions[%d]", i)
+		if direction.Product == "" {
+			errs = append(errs, fmt.Errorf("%s.product: must not be empty", path))
+		}
+		if direction.Amount <= 0 {
+			errs = append(errs, fmt.Errorf("%s.amount: must be positive, got %d", path, direction.Amount))
+		}
+		if direction.Interval <= 0 {
+			errs = append(errs, fmt.Errorf("%s.interval: must be positive, got %d", path, direction.Interval))
+		}
+		if direction.Minimum < 0 {
+			errs = append(errs, fmt.Errorf("%s.minimum: must not be negative, got %d", path, direction.Minimum))
+		}
+		if direction.Price < 0 {
+			errs = append(errs, fmt.Errorf("%s.price: must not be negative, got %d", path, direction.Price))
+		}
+
+		for j, input := range direction.ProductInputList {
+			inputPath := fmt.Sprintf("%s.productInputList[%d]", path, j)
+			if input.Product == "" {
+				errs = append(errs, fmt.Errorf("%s.product: must not be empty", inputPath))
+			}
+			if input.Amount <= 0 {
+				errs = append(errs, fmt.Errorf("%s.amount: must be positive, got %d", inputPath, input.Amount))
+			}
+			if input.Store == "" && len(input.Stores) == 0 && !input.Discover {
+				errs = append(errs, fmt.Errorf("%s: needs a store, stores or discover", inputPath))
+			}
+			if input.Store != "" {
+				if err := validateStore(input.Store); err != nil {
+					errs = append(errs, fmt.Errorf("%s.store: %w", inputPath, err))
+				}
+			}
+			for k, store := range input.Stores {
+				if err := validateStore(store); err != nil {
+					errs = append(errs, fmt.Errorf("%s.stores[%d]: %w", inputPath, k, err))
+				}
+			}
+			if !validStrategy(input.Strategy) {
+				errs = append(errs, fmt.Errorf("%s.strategy: must be %s, %s, %s or %s, got %q", inputPath,
+					StrategyFirstInStock, StrategyCheapest, StrategyNearest, StrategyRoundRobin, input.Strategy))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateStore checks that a store is an absolute URL such as http://woodworker, or grpc://woodworker for its Shop service
+func validateStore(store string) error {
+	if store == "" {
+		return errors.New("must not be empty")
+	}
+	u, err := url.Parse(store)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("must be an absolute URL such as http://woodworker, got %q", store)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "grpc" {
+		return fmt.Errorf("must be an http, https or grpc URL, got %q", store)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Types of events, the same as the types of Kubernetes Events
+const (
+	EventTypeNormal  = "Normal"
+	EventTypeWarning = "Warning"
+)
+
+// Reasons of the events a worker records
+const (
+	ReasonProduced         = "Produced"         // a product was made
+	ReasonPurchaseFailed   = "PurchaseFailed"   // an input could not be bought from its store
+	ReasonOutOfStock       = "OutOfStock"       // a buyer asked for more than the worker had
+	ReasonBelowMinimum     = "BelowMinimum"     // a product fell below its minimum, the worker is no longer ready
+	ReasonRestocked        = "Restocked"        // a product is back at its minimum
+	ReasonStoreUnavailable = "StoreUnavailable" // a store failed too often, the worker skips it for a while
+)
+
+// EventRecorder records the notable things a worker does, such as Kubernetes Events on its pod
+type EventRecorder interface {
+	Event(eventType, reason, message string)
+}
+
+// noEvents drops every event, it is the recorder of a new worker
+type noEvents struct{}
+
+func (noEvents) Event(string, string, string) {}
+
+// SetEventRecorder sends the events of the worker to the recorder
+func (w *Worker) SetEventRecorder(recorder EventRecorder) {
+	w.events = recorder
+}
+
+// minimumTracker remembers which products are below their minimum,
+// so BelowMinimum and Restocked are only recorded when that changes.
+type minimumTracker struct {
+	lock  sync.Mutex
+	below map[string]bool
+}
+
+func newMinimumTracker(directions []Direction) *minimumTracker {
+	t := &minimumTracker{below: make(map[string]bool)}
+	for _, direction := range directions {
+		// a new worker starts empty, so every product with a minimum starts below it
+		t.below[direction.Product] = direction.Minimum > 0
+	}
+	return t
+}
+
+// checkMinimum records an event for every product that crossed its minimum since the last check
+func (w *Worker) checkMinimum() {
+	inventory := w.inventory.Snapshot()
+	w.minimum.lock.Lock()
+	defer w.minimum.lock.Unlock()
+	for _, direction := range w.directions {
+		if direction.Minimum <= 0 {
+			continue
+		}
+		below := inventory[direction.Product] < direction.Minimum
+		if below == w.minimum.below[direction.Product] {
+			continue
+		}
+		w.minimum.below[direction.Product] = below
+		if below {
+			w.events.Event(EventTypeWarning, ReasonBelowMinimum,
+				fmt.Sprintf("%s is below its minimum: %d of %d", direction.Product, inventory[direction.Product], direction.Minimum))
+		} else {
+			w.events.Event(EventTypeNormal, ReasonRestocked,
+				fmt.Sprintf("%s is back above its minimum: %d of %d", direction.Product, inventory[direction.Product], direction.Minimum))
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package worker
+
+// Buy, PlaceOrderAt and AddInventory let the external tests buy and stock up, as the schedule does
+var (
+	Buy          = (*Worker).buy
+	PlaceOrderAt = (*Worker).placeOrder
+	AddInventory = (*Worker).addInventory
+	// StoreClientOf returns the client the worker trades with a store through, gRPC for grpc:// URLs
+	StoreClientOf = (*Worker).storeClient
+)
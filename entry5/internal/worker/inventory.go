@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"maps"
+	"sync"
+)
+
+// Inventory is the stock of a worker.
+// Items are taken out of the inventory in two steps: Reserve holds them so no one else can take them,
+// then the Reservation is either committed (the items are gone) or released (the items are back).
+// Checking and holding happen under one lock, so concurrent sales can never drive the inventory negative.
+type Inventory struct {
+	lock     sync.Mutex
+	items    map[string]int // items is the stock on hand, including reserved items
+	reserved map[string]int // reserved is the stock held by open reservations
+	epoch    int            // epoch changes when the inventory is replaced, invalidating older reservations
+}
+
+// Reservation holds items of an inventory until it is committed or released
+type Reservation struct {
+	inventory *Inventory
+	items     map[string]int
+	epoch     int
+	done      bool
+}
+
+func NewInventory() *Inventory {
+	return &Inventory{
+		items:    make(map[string]int),
+		reserved: make(map[string]int),
+	}
+}
+
+// Add puts items into the inventory
+func (i *Inventory) Add(item string, amount int) int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.items[item] += amount
+	return i.items[item]
+}
+
+// Replace sets the whole inventory, dropping every open reservation
+func (i *Inventory) Replace(items map[string]int) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.items = make(map[string]int, len(items))
+	maps.Copy(i.items, items)
+	i.reserved = make(map[string]int)
+	i.epoch++
+}
+
+// Amount returns the stock on hand of an item, including reserved items
+func (i *Inventory) Amount(item string) int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.items[item]
+}
+
+// Available returns the stock of an item that can still be reserved
+func (i *Inventory) Available(item string) int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.items[item] - i.reserved[item]
+}
+
+// Snapshot returns a copy of the stock on hand
+func (i *Inventory) Snapshot() map[string]int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return maps.Clone(i.items)
+}
+
+// Reserve holds all of the items, or none of them if any item is short.
+// It returns ErrNotEnoughInventory when the reservation can't be made.
+func (i *Inventory) Reserve(items map[string]int) (*Reservation, error) {
+	return i.ReserveKeeping(items, nil)
+}
+
+// ReserveKeeping is Reserve, but it leaves at least the kept amount of each item available
+func (i *Inventory) ReserveKeeping(items, keep map[string]int) (*Reservation, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	for item, amount := range items {
+		if amount < 0 || i.items[item]-i.reserved[item]-keep[item] < amount {
+			return nil, ErrNotEnoughInventory
+		}
+	}
+	for item, amount := range items {
+		i.reserved[item] += amount
+	}
+	return &Reservation{
+		inventory: i,
+		items:     maps.Clone(items),
+		epoch:     i.epoch,
+	}, nil
+}
+
+// Commit removes the reserved items from the inventory. It does nothing if the reservation is already done.
+func (r *Reservation) Commit() {
+	r.finish(true)
+}
+
+// Release returns the reserved items to the inventory. It does nothing if the reservation is already done.
+func (r *Reservation) Release() {
+	r.finish(false)
+}
+
+func (r *Reservation) finish(commit bool) {
+	i := r.inventory
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if r.done || r.epoch != i.epoch {
+		return
+	}
+	r.done = true
+	for item, amount := range r.items {
+		i.reserved[item] -= amount
+		if i.reserved[item] == 0 {
+			delete(i.reserved, item)
+		}
+		if commit {
+			i.items[item] -= amount
+			if i.items[item] == 0 {
+				delete(i.items, item) // sold out items leave the inventory, and the published ledger
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package worker
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons a buy fails, used as the reason label of civ_worker_buy_failures_total
+const (
+	BuyFailureConflict        = "conflict"         // the store did not have enough stock (409)
+	BuyFailurePaymentRequired = "payment_required" // the worker could not afford the sale (402)
+	BuyFailureStatus          = "status"           // the store answered with any other non-200 status
+	BuyFailureTransport       = "transport"        // the request never got an answer from the store
+	BuyFailureNoStore         = "no_store"         // the input has no store to buy from, none was listed or discovered
+	BuyFailureUnknownProduct  = "unknown_product"  // the store does not make the product (404)
+	BuyFailureTooManyOrders   = "too_many_orders"  // the store has as many pending orders of the worker as it takes (429)
+)
+
+// Metrics are the prometheus collectors of a worker.
+// They work without being registered, so a worker only exposes them when asked to.
+type Metrics struct {
+	produced           *prometheus.CounterVec
+	sold               *prometheus.CounterVec
+	bought             *prometheus.CounterVec
+	buyFailures        *prometheus.CounterVec
+	productionCycle    *prometheus.HistogramVec
+	storeSaveDuration  prometheus.Histogram
+	storeSaveErrors    prometheus.Counter
+	flushes            *prometheus.CounterVec
+	flushChanges       prometheus.Histogram
+	publishBackoff     prometheus.Gauge
+	circuitOpened      *prometheus.CounterVec
+	inventoryCollector *inventoryCollector
+}
+
+func newMetrics(w *Worker) *Metrics {
+	return &Metrics{
+		produced: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "civ_worker_produced_total",
+			Help: "Units produced, by product.",
+		}, []string{"product"}),
+		sold: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "civ_worker_sold_total",
+			Help: "Units sold to other workers, by product.",
+		}, []string{"product"}),
+		bought: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "civ_worker_bought_total",
+			Help: "Units bought from other workers, by product.",
+		}, []string{"product"}),
+		buyFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "civ_worker_buy_failures_total",
+			Help: "Buys that failed, by product and reason (conflict, payment_required, status, transport, no_store).",
+		}, []string{"product", "reason"}),
+		productionCycle: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "civ_worker_production_cycle_seconds",
+			Help:    "Time between two productions of a product, including the time spent buying its inputs.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 10), // 1s to 512s
+		}, []string{"product"}),
+		storeSaveDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "civ_worker_store_save_duration_seconds",
+			Help:    "Time to save the ledger to the inventory store, such as patching the pod annotations.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		storeSaveErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "civ_worker_store_save_errors_total",
+			Help: "Failed saves of the ledger to the inventory store.",
+		}),
+		flushes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "civ_worker_publish_flushes_total",
+			Help: "Saves of the coalesced ledger changes, by result (success, error).",
+		}, []string{"result"}),
+		flushChanges: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "civ_worker_publish_flush_changes",
+			Help:    "Ledger changes coalesced into a single save.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 8), // 1 to 128
+		}),
+		publishBackoff: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "civ_worker_publish_backoff_seconds",
+			Help: "Extra wait before the next save because earlier saves failed, 0 when saves succeed.",
+		}),
+		circuitOpened: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "civ_worker_store_circuit_opened_total",
+			Help: "Times a store failed too often and was skipped for a backoff, by store.",
+		}, []string{"store"}),
+		inventoryCollector: &inventoryCollector{
+			worker: w,
+			inventory: prometheus.NewDesc("civ_worker_inventory",
+				"Units in stock, by product.", []string{"product"}, nil),
+			wallet: prometheus.NewDesc("civ_worker_wallet_coins",
+				"Coins in the wallet of the worker.", nil, nil),
+		},
+	}
+}
+
+// register adds every collector to the registerer
+func (m *Metrics) register(reg prometheus.Registerer) error {
+	var errs []error
+	for _, c := range []prometheus.Collector{
+		m.produced,
+		m.sold,
+		m.bought,
+		m.buyFailures,
+		m.productionCycle,
+		m.storeSaveDuration,
+		m.storeSaveErrors,
+		m.flushes,
+		m.flushChanges,
+		m.publishBackoff,
+		m.circuitOpened,
+		m.inventoryCollector,
+	} {
+		errs = append(errs, reg.Register(c))
+	}
+	return errors.Join(errs...)
+}
+
+// inventoryCollector reads the inventory and the wallet when the metrics are scraped,
+// so the gauges are never behind the worker.
+type inventoryCollector struct {
+	worker    *Worker
+	inventory *prometheus.Desc
+	wallet    *prometheus.Desc
+}
+
+func (c *inventoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.inventory
+	ch <- c.wallet
+}
+
+func (c *inventoryCollector) Collect(ch chan<- prometheus.Metric) {
+	inventory := c.worker.inventory.Snapshot()
+	// every product the worker makes has a gauge, even before the first one is produced
+	for _, direction := range c.worker.directions {
+		if _, ok := inventory[direction.Product]; !ok {
+			inventory[direction.Product] = 0
+		}
+	}
+	for product, amount := range inventory {
+		ch <- prometheus.MustNewConstMetric(c.inventory, prometheus.GaugeValue, float64(amount), product)
+	}
+	ch <- prometheus.MustNewConstMetric(c.wallet, prometheus.GaugeValue, float64(c.worker.Wallet()))
+}
@@ -0,0 +1,316 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// OrderStatus is where an order is in its life: pending until it is filled or cancelled
+type OrderStatus string
+
+const (
+	OrderPending   OrderStatus = "pending"   // the order waits in the order book for stock
+	OrderFilled    OrderStatus = "filled"    // the products were taken out of the inventory for the buyer
+	OrderCancelled OrderStatus = "cancelled" // the order was dropped, the buyer keeps its payment
+	OrderLost      OrderStatus = "lost"      // the store lost the pending order, such as in a restart. Only buyers set it, see orderLostAfter.
+)
+
+// settledOrderTTL is how long the order book remembers a filled or cancelled order for its buyer.
+// It is longer than a buyer waits on an order its store doesn't know, so a buyer never mistakes a settled order for a lost one.
+const settledOrderTTL = time.Hour
+
+// Limits of the standing orders: a single order can't ask for more than maxOrderQuantity units,
+// and a buyer can't have more than maxPendingOrders orders waiting, so no buyer corners the production
+const (
+	maxOrderQuantity = 100
+	maxPendingOrders = 5
+)
+
+var (
+	// ErrOrderNotFound is returned for an order the order book doesn't know, or no longer remembers
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrOrderSettled is returned when cancelling an order that is already filled or cancelled
+	ErrOrderSettled = errors.New("order is already settled")
+	// ErrNotOrderOwner is returned when cancelling an order another buyer placed
+	ErrNotOrderOwner = errors.New("the order belongs to another buyer")
+	// ErrOrderTooLarge is returned for a standing order of more than maxOrderQuantity units
+	ErrOrderTooLarge = fmt.Errorf("a standing order can't be for more than %d units", maxOrderQuantity)
+	// ErrTooManyOrders is returned for a standing order of a buyer that already has maxPendingOrders orders waiting
+	ErrTooManyOrders = fmt.Errorf("a buyer can't have more than %d pending orders", maxPendingOrders)
+)
+
+// Order is an order of a buyer. A standing order waits in the order book of the store until there is stock.
+// The buyer sets aside the payment when it places the order, and keeps whatever the total doesn't use.
+type Order struct {
+	ID       string      `json:"id"`
+	Product  string      `json:"product"`
+	Quantity int         `json:"quantity"`
+	Payment  int         `json:"payment"`            // Payment is the most the buyer pays for the whole order
+	Callback string      `json:"callback,omitempty"` // Callback is the URL the order is posted to once it is settled
+	Buyer    string      `json:"buyer,omitempty"`    // Buyer is who placed the order, see auth.Identity.Principal. Only the buyer may cancel it.
+	Status   OrderStatus `json:"status"`
+	Price    int         `json:"price,omitempty"`  // Price is the price of a single unit when the order was filled
+	Total    int         `json:"total,omitempty"`  // Total is the amount of coins charged
+	Reason   string      `json:"reason,omitempty"` // Reason is why the order was cancelled
+	Created  time.Time   `json:"created"`
+	Settled  *time.Time  `json:"settled,omitempty"` // Settled is when the order was filled or cancelled
+}
+
+// orderBook keeps the orders of the buyers, first in first out for every product
+type orderBook struct {
+	lock    sync.Mutex
+	orders  map[string]*Order   // orders are every order the book remembers, by ID
+	pending map[string][]*Order // pending are the orders waiting for stock, by product, oldest first
+	settled []string            // settled are the IDs of the settled orders, oldest first
+}
+
+func newOrderBook() *orderBook {
+	return &orderBook{
+		orders:  make(map[string]*Order),
+		pending: make(map[string][]*Order),
+	}
+}
+
+// PlaceOrder takes an order of a buyer. An order that isn't standing is filled from the stock right away or fails
+// like Sell. A standing order joins the order book and is filled as production completes, oldest order first.
+// Buyers are told apart by their buyer identity, or by their callback when they have none.
+func (w *Worker) PlaceOrder(ctx context.Context, product string, quantity, payment int, callback, buyer string, standing bool) (Order, error) {
+	now := w.clock.Now()
+	order := &Order{
+		ID:       newOrderID(),
+		Product:  product,
+		Quantity: quantity,
+		Payment:  payment,
+		Callback: callback,
+		Buyer:    buyer,
+		Status:   OrderPending,
+		Created:  now,
+	}
+
+	if !standing {
+		receipt, err := w.Sell(ctx, product, quantity, payment)
+		if err != nil {
+			return Order{}, err
+		}
+		order.Callback = "" // the buyer has the answer, there is nothing to deliver
+		order.Status = OrderFilled
+		order.Price = receipt.Price
+		order.Total = receipt.Total
+		order.Settled = &now
+		w.orders.lock.Lock()
+		w.orders.remember(order)
+		w.orders.lock.Unlock()
+		return *order, nil
+	}
+
+	if !w.makes(product) {
+		return Order{}, ErrUnknownProduct
+	}
+	if quantity > maxOrderQuantity {
+		return Order{}, ErrOrderTooLarge
+	}
+	w.orders.lock.Lock()
+	if w.orders.pendingOf(buyer, callback) >= maxPendingOrders {
+		w.orders.lock.Unlock()
+		return Order{}, ErrTooManyOrders
+	}
+	w.orders.orders[order.ID] = order
+	w.orders.pending[product] = append(w.orders.pending[product], order)
+	w.orders.lock.Unlock()
+	slog.InfoContext(ctx, "Order placed", "order", order.ID, "product", product, "quantity", quantity)
+	// the stock on hand may already cover it, the buyer learns that from the answer rather than a callback
+	w.fillOrders(ctx, product, order)
+
+	w.orders.lock.Lock()
+	defer w.orders.lock.Unlock()
+	return *order, nil
+}
+
+// Order returns an order of the order book
+func (w *Worker) Order(id string) (Order, error) {
+	w.orders.lock.Lock()
+	defer w.orders.lock.Unlock()
+	order, ok := w.orders.orders[id]
+	if !ok {
+		return Order{}, ErrOrderNotFound
+	}
+	return *order, nil
+}
+
+// Orders returns every order the order book remembers, oldest first
+func (w *Worker) Orders() []Order {
+	w.orders.lock.Lock()
+	defer w.orders.lock.Unlock()
+	orders := make([]Order, 0, len(w.orders.orders))
+	for _, order := range w.orders.orders {
+		orders = append(orders, *order)
+	}
+	slices.SortFunc(orders, func(a, b Order) int { return a.Created.Compare(b.Created) })
+	return orders
+}
+
+// CancelOrder drops a pending order, the buyer keeps its payment.
+// When both the order and the caller have a buyer, only the buyer that placed the order may cancel it.
+func (w *Worker) CancelOrder(ctx context.Context, id, buyer string) (Order, error) {
+	w.orders.lock.Lock()
+	defer w.orders.lock.Unlock()
+	order, ok := w.orders.orders[id]
+	if !ok {
+		return Order{}, ErrOrderNotFound
+	}
+	if order.Buyer != "" && buyer != "" && order.Buyer != buyer {
+		return Order{}, ErrNotOrderOwner
+	}
+	if order.Status != OrderPending {
+		return *order, ErrOrderSettled
+	}
+	w.orders.cancel(order, "cancelled by the buyer", w.clock.Now())
+	slog.InfoContext(ctx, "Order cancelled", "order", id, "product", order.Product)
+	return *order, nil
+}
+
+// fillOrders fills the pending orders of a product from the stock, oldest first.
+// An order the stock can't cover yet waits, and the stock it needs is held back from the younger orders:
+// they are only filled from what is left over, so a large order isn't starved by a stream of small ones.
+// Orders whose payment no longer covers the price are cancelled. The settled orders are delivered,
+// except the one being placed, if any, whose buyer gets it as the answer.
+func (w *Worker) fillOrders(ctx context.Context, product string, placing *Order) {
+	var settled []Order
+	held := 0 // held is the stock the older orders that wait need
+	w.orders.lock.Lock()
+	for _, order := range slices.Clone(w.orders.pending[product]) {
+		price := w.pricing.Price(product, w.inventory.Available(product))
+		if order.Payment < price*order.Quantity {
+			w.orders.cancel(order, fmt.Sprintf("the price rose to %d, more than the payment covers", price), w.clock.Now())
+			if order != placing {
+				settled = append(settled, *order)
+			}
+			continue
+		}
+		reservation, err := w.inventory.ReserveKeeping(map[string]int{product: order.Quantity}, map[string]int{product: held})
+		if err != nil {
+			held += order.Quantity // not enough stock yet, the order waits for the next production
+			continue
+		}
+		w.deposit(price * order.Quantity)
+		w.pricing.RecordSale(product, order.Quantity)
+		w.commitReservation(ctx, reservation)
+		w.metrics.sold.WithLabelValues(product).Add(float64(order.Quantity))
+		w.streamEvent(StreamEvent{Kind: StreamSold, Product: product, Amount: order.Quantity, Total: price * order.Quantity})
+
+		now := w.clock.Now()
+		order.Status = OrderFilled
+		order.Price = price
+		order.Total = price * order.Quantity
+		order.Settled = &now
+		w.orders.pending[product] = slices.DeleteFunc(w.orders.pending[product], func(o *Order) bool { return o == order })
+		w.orders.remember(order)
+		if order != placing {
+			settled = append(settled, *order)
+		}
+		slog.InfoContext(ctx, "Order filled", "order", order.ID, "product", product, "quantity", order.Quantity, "total", order.Total)
+	}
+	w.orders.lock.Unlock()
+
+	for _, order := range settled {
+		w.deliver(ctx, order)
+	}
+}
+
+// heldForOrders returns the units of a product spot sales leave for the oldest pending order, so its stock can build up.
+// Only the oldest order is held for, the other orders would keep the stock from spot sales for good.
+func (w *Worker) heldForOrders(product string) int {
+	w.orders.lock.Lock()
+	defer w.orders.lock.Unlock()
+	if pending := w.orders.pending[product]; len(pending) > 0 {
+		return pending[0].Quantity
+	}
+	return 0
+}
+
+// deliver posts a settled order to its callback. A buyer that misses it still finds the order by polling.
+func (w *Worker) deliver(ctx context.Context, order Order) {
+	if order.Callback == "" {
+		return
+	}
+	payload, err := json.Marshal(order)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to marshal order", "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, order.Callback, bytes.NewReader(payload))
+	if err != nil {
+		slog.WarnContext(ctx, "invalid order callback", "order", order.ID, "callback", order.Callback, "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := w.storeClients.tokens.Token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to deliver order", "order", order.ID, "callback", order.Callback, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.WarnContext(ctx, "buyer refused the order", "order", order.ID, "callback", order.Callback, "status", resp.Status)
+	}
+}
+
+// pendingOf counts the pending orders of a buyer, or of the callback when the buyer is unknown.
+// The lock of the order book must be held.
+func (b *orderBook) pendingOf(buyer, callback string) int {
+	count := 0
+	for _, orders := range b.pending {
+		for _, order := range orders {
+			if buyer != "" && order.Buyer == buyer || buyer == "" && order.Buyer == "" && order.Callback == callback {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// cancel settles a pending order as cancelled. The lock of the order book must be held.
+func (b *orderBook) cancel(order *Order, reason string, now time.Time) {
+	order.Status = OrderCancelled
+	order.Reason = reason
+	order.Settled = &now
+	b.pending[order.Product] = slices.DeleteFunc(b.pending[order.Product], func(o *Order) bool { return o == order })
+	b.remember(order)
+}
+
+// remember keeps a settled order for its buyer, forgetting the ones settled more than settledOrderTTL before it.
+// The lock of the order book must be held.
+func (b *orderBook) remember(order *Order) {
+	b.orders[order.ID] = order
+	b.settled = append(b.settled, order.ID)
+	for len(b.settled) > 0 {
+		oldest, ok := b.orders[b.settled[0]]
+		if ok && order.Settled.Sub(*oldest.Settled) < settledOrderTTL {
+			break
+		}
+		delete(b.orders, b.settled[0])
+		b.settled = b.settled[1:]
+	}
+}
+
+// newOrderID returns a random order ID, such as ord_1f2e3d4c5b6a7980
+func newOrderID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "ord_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// priceHalfLife is how long it takes for a sale or rejection to count half as much towards the price
+	priceHalfLife = 30 * time.Second
+	// rejectionWeight is how many units of demand a rejected (409 Conflict) request counts as
+	rejectionWeight = 2.0
+	// the price of a product stays between these multiples of its base price
+	minPriceMultiplier = 0.5
+	maxPriceMultiplier = 5.0
+)
+
+// PricingEngine adjusts the price of each product based on supply and demand.
+// Supply is the inventory of the product compared to its minimum,
+// demand is the recent volume of sales plus the requests that were rejected for lack of inventory.
+type PricingEngine struct {
+	lock     sync.Mutex
+	now      func() time.Time
+	products map[string]*productDemand
+}
+
+// productDemand tracks the recent demand of a single product.
+// sold and rejected decay towards zero over time so only recent activity counts.
+type productDemand struct {
+	base     int // base is the price from the directions
+	minimum  int // minimum is the inventory the worker tries to keep
+	sold     float64
+	rejected float64
+	updated  time.Time
+}
+
+// NewPricingEngine creates a pricing engine for the products in the directions
+func NewPricingEngine(directions []Direction) *PricingEngine {
+	p := &PricingEngine{
+		now:      time.Now,
+		products: make(map[string]*productDemand, len(directions)),
+	}
+	for _, direction := range directions {
+		p.products[direction.Product] = &productDemand{
+			base:    direction.Price,
+			minimum: direction.Minimum,
+			updated: p.now(),
+		}
+	}
+	return p
+}
+
+// decay reduces the recorded demand by the time passed since the last update
+func (d *productDemand) decay(now time.Time) {
+	elapsed := now.Sub(d.updated)
+	if elapsed <= 0 {
+		return
+	}
+	factor := math.Pow(0.5, float64(elapsed)/float64(priceHalfLife))
+	d.sold *= factor
+	d.rejected *= factor
+	d.updated = now
+}
+
+// RecordSale records units sold through the sell endpoint
+func (p *PricingEngine) RecordSale(product string, quantity int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if d, ok := p.products[product]; ok {
+		d.decay(p.now())
+		d.sold += float64(quantity)
+	}
+}
+
+// RecordRejection records units that were requested but could not be sold
+func (p *PricingEngine) RecordRejection(product string, quantity int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if d, ok := p.products[product]; ok {
+		d.decay(p.now())
+		d.rejected += float64(quantity)
+	}
+}
+
+// Price returns the current price of a single unit of the product given its inventory.
+// Products the worker doesn't make have no price, Sell turns them down.
+func (p *PricingEngine) Price(product string, inventory int) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	d, ok := p.products[product]
+	if !ok {
+		return 0
+	}
+	d.decay(p.now())
+	return d.price(inventory)
+}
+
+// Prices returns the current price of every product given the inventory
+func (p *PricingEngine) Prices(inventory map[string]int) map[string]int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	prices := make(map[string]int, len(p.products))
+	now := p.now()
+	for product, d := range p.products {
+		d.decay(now)
+		prices[product] = d.price(inventory[product])
+	}
+	return prices
+}
+
+// price scales the base price by how scarce the product is.
+// Demand is the recent sales and rejections plus the minimum the worker wants to keep,
+// supply is the inventory. More demand than supply raises the price, more supply lowers it.
+func (d *productDemand) price(inventory int) int {
+	if d.base <= 0 {
+		return 0
+	}
+	demand := d.sold + rejectionWeight*d.rejected + float64(max(d.minimum, 1))
+	supply := float64(max(inventory, 0)) + 1
+	multiplier := min(max(demand/supply, minPriceMultiplier), maxPriceMultiplier)
+	return max(int(math.Round(float64(d.base)*multiplier)), 1)
+}
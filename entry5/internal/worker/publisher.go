@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// PublishOptions configures how often the ledger of a worker is saved to its store
+type PublishOptions struct {
+	Interval   time.Duration // Interval is the longest a change waits before it is saved
+	Threshold  int           // Threshold is the number of changes that are saved right away, without waiting for the interval
+	MaxBackoff time.Duration // MaxBackoff is the longest wait between two saves after the store fails
+}
+
+// claimInterval is how often the publisher looks for ledgers released by stopped workers of the shop
+const claimInterval = 10 * time.Second
+
+// Publish saves the ledger to the store until the context is canceled.
+// Changes are coalesced: they are saved together every interval, or as soon as the threshold is hit.
+// When the store fails, or the API server asks for fewer requests, saves back off exponentially.
+// A last save is made when the context is canceled, so a stopped worker leaves its final state behind.
+// With a store that hands ledgers over, the ledgers released by stopped workers of the shop are claimed along the way.
+func (w *Worker) Publish(ctx context.Context, opts PublishOptions) {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = 20
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Minute
+	}
+	w.publishThreshold.Store(int64(opts.Threshold))
+
+	handover, _ := w.store.(Handover)
+	var claimed time.Time
+
+	failures := 0
+	timer := time.NewTimer(opts.Interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			if err := w.flush(flushCtx); err != nil {
+				slog.ErrorContext(ctx, "failed to save the final ledger", "error", err)
+			}
+			cancel()
+			return
+		case <-w.publishNow:
+			if failures > 0 {
+				continue // backing off, the timer saves the changes
+			}
+		case <-timer.C:
+		}
+
+		wait := opts.Interval
+		if err := w.flush(ctx); err != nil {
+			failures++
+			wait = backoff(opts.Interval, opts.MaxBackoff, failures, err)
+			slog.WarnContext(ctx, "failed to save ledger, backing off", "error", err, "failures", failures, "wait", wait)
+		} else {
+			failures = 0
+		}
+		if handover != nil && failures == 0 && time.Since(claimed) >= claimInterval {
+			if err := w.claimReleased(ctx, handover); err != nil {
+				slog.WarnContext(ctx, "failed to claim a released ledger", "error", err)
+			}
+			claimed = time.Now()
+		}
+		w.metrics.publishBackoff.Set(max(wait-opts.Interval, 0).Seconds())
+		timer.Reset(wait)
+	}
+}
+
+// markDirty records a change to the ledger, waking the publisher when the threshold is hit
+func (w *Worker) markDirty() {
+	if w.dirty.Add(1) < w.publishThreshold.Load() {
+		return
+	}
+	select {
+	case w.publishNow <- struct{}{}:
+	default: // the publisher is already awake
+	}
+}
+
+// flush saves the ledger if it changed since the last save
+func (w *Worker) flush(ctx context.Context) error {
+	changes := w.dirty.Swap(0)
+	if changes == 0 {
+		return nil
+	}
+	ctx, span := tracer.Start(ctx, "Worker.flush")
+	defer span.End()
+
+	if err := w.UpdateStoreLog(ctx); err != nil {
+		w.dirty.Add(changes) // still not saved, try again with the next flush
+		w.metrics.flushes.WithLabelValues("error").Inc()
+		return err
+	}
+	w.metrics.flushes.WithLabelValues("success").Inc()
+	w.metrics.flushChanges.Observe(float64(changes))
+	return nil
+}
+
+// backoff returns the wait after the given number of failed saves in a row.
+// The API server can ask for a longer wait, with a 429 Too Many Requests for example.
+func backoff(interval, maxBackoff time.Duration, failures int, err error) time.Duration {
+	wait := interval << min(failures, 16)
+	if seconds, ok := apierrors.SuggestsClientDelay(err); ok {
+		wait = max(wait, time.Duration(seconds)*time.Second)
+	}
+	return min(wait, maxBackoff)
+}
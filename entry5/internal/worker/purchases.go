@@ -0,0 +1,261 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// Standing orders of a buyer: the payment set aside is the price when the order is placed times orderHeadroom,
+// so a rising price doesn't cancel it. Pending orders are polled every orderPollInterval,
+// or every orderCallbackPollInterval when the store calls back, in case the callback is lost.
+// A replica behind the same Service may not know the order, so an unknown order is only given up on as lost
+// when no replica of the store has known it for orderLostAfter. Stores remember settled orders for settledOrderTTL,
+// longer than that, so an order a store forgot was still pending and the payment never left.
+const (
+	orderHeadroom             = 2
+	orderPollInterval         = 10 * time.Second
+	orderCallbackPollInterval = time.Minute
+	orderLostAfter            = 10 * time.Minute
+)
+
+// purchases are the standing orders a worker placed with its stores, by order ID
+type purchases struct {
+	lock   sync.Mutex
+	orders map[string]*purchase
+}
+
+// purchase is a standing order placed with a store, waiting to be delivered
+type purchase struct {
+	order   Order
+	store   string
+	checked time.Time // checked is when the order was placed or last polled
+	seen    time.Time // seen is when the store last knew the order
+}
+
+// SetCallbackURL makes the stores post settled standing orders to the URL, instead of waiting to be polled
+func (w *Worker) SetCallbackURL(url string) {
+	w.callbackURL = url
+}
+
+// sourceStanding gets the input through a standing order. While an order for the product is pending it is only polled,
+// so the worker doesn't ask its stores again every job. It returns whether the input was delivered.
+func (w *Worker) sourceStanding(ctx context.Context, input ProductInput, stores []string) bool {
+	if p := w.pendingPurchase(input.Product); p != nil {
+		return w.pollPurchase(ctx, p)
+	}
+
+	for _, store := range stores {
+		if !w.sourcing.allow(store, w.clock.Now()) {
+			continue
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+		order, err := w.placeOrder(attemptCtx, input, store)
+		cancel()
+		switch {
+		case err == nil:
+			return order.Status == OrderFilled
+		case errors.Is(err, ErrNotEnoughInventory), errors.Is(err, ErrInsufficientPayment), errors.Is(err, ErrUnknownProduct), errors.Is(err, ErrTooManyOrders):
+			w.sourcing.succeeded(store) // the store is up, it only turned the order down
+		case ctx.Err() != nil:
+			return false // the worker is stopping, that is not the fault of the store
+		default:
+			w.storeFailed(ctx, store, err)
+		}
+	}
+	return false
+}
+
+// placeOrder places a standing order with the store, setting the payment aside until the order is settled
+func (w *Worker) placeOrder(ctx context.Context, input ProductInput, store string) (Order, error) {
+	price, err := w.price(ctx, store, input.Product)
+	if err != nil {
+		return Order{}, err
+	}
+	if price == math.MaxInt {
+		return Order{}, ErrUnknownProduct // the store has no price for it
+	}
+	payment := min(price*input.Amount*orderHeadroom, w.Wallet())
+	if payment < price*input.Amount {
+		w.buyFailed(input, BuyFailurePaymentRequired, fmt.Sprintf("%d coins can't cover an order at %d each", w.Wallet(), price))
+		return Order{}, ErrInsufficientPayment
+	}
+	if _, ok := w.withdraw(payment); !ok {
+		return Order{}, ErrInsufficientPayment
+	}
+
+	var order Order
+	client, err := w.storeClient(store)
+	if err == nil {
+		order, err = client.PlaceOrder(ctx, input.Product, input.Amount, payment, w.callbackURL)
+	}
+	if err != nil {
+		w.deposit(payment)
+		switch {
+		case errors.Is(err, ErrInsufficientPayment):
+			w.buyFailed(input, BuyFailurePaymentRequired, fmt.Sprintf("%d coins is not enough", payment))
+		case errors.Is(err, ErrNotEnoughInventory):
+			w.buyFailed(input, BuyFailureConflict, "the store is out of stock")
+		case errors.Is(err, ErrUnknownProduct):
+			w.buyFailed(input, BuyFailureUnknownProduct, fmt.Sprintf("%s does not make %s", store, input.Product))
+		case errors.Is(err, ErrTooManyOrders):
+			w.buyFailed(input, BuyFailureTooManyOrders, "the store has too many pending orders of the worker")
+		case errors.Is(err, ErrStoreStatus):
+			w.buyFailed(input, BuyFailureStatus, err.Error())
+		default:
+			w.buyFailed(input, BuyFailureTransport, err.Error())
+		}
+		return Order{}, err
+	}
+
+	p := &purchase{order: order, store: store, checked: w.clock.Now(), seen: w.clock.Now()}
+	p.order.Payment = payment // the payment set aside here is what comes back, whatever the store says
+	w.purchases.lock.Lock()
+	w.purchases.orders[order.ID] = p
+	w.purchases.lock.Unlock()
+	slog.InfoContext(ctx, "Placed order", "order", order.ID, "store", store, "product", input.Product, "amount", input.Amount, "payment", payment)
+
+	if order.Status != OrderPending {
+		w.settle(ctx, order) // filled from the stock on hand
+	}
+	return order, nil
+}
+
+// pollPurchase asks the store about a pending order when it is due. It returns whether the order was delivered.
+func (w *Worker) pollPurchase(ctx context.Context, p *purchase) bool {
+	interval := orderPollInterval
+	if w.callbackURL != "" {
+		interval = orderCallbackPollInterval
+	}
+	now := w.clock.Now()
+	w.purchases.lock.Lock()
+	due := now.Sub(p.checked) >= interval
+	if due {
+		p.checked = now
+	}
+	id, store := p.order.ID, p.store
+	w.purchases.lock.Unlock()
+	if !due {
+		return false
+	}
+
+	client, err := w.storeClient(store)
+	if err != nil {
+		return false
+	}
+	orderCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+	order, err := client.Order(orderCtx, id)
+	cancel()
+	switch {
+	case err == nil:
+		w.purchases.lock.Lock()
+		p.seen = now
+		w.purchases.lock.Unlock()
+		return order.Status != OrderPending && w.settle(ctx, order) && order.Status == OrderFilled
+	case errors.Is(err, ErrOrderNotFound):
+		w.purchases.lock.Lock()
+		lost := now.Sub(p.seen) >= orderLostAfter
+		w.purchases.lock.Unlock()
+		if lost {
+			// the store forgot the order, such as after a restart, so the payment never left
+			w.settle(ctx, Order{ID: id, Status: OrderLost, Reason: "the store lost the order"})
+		}
+		return false
+	case ctx.Err() != nil:
+		return false
+	default:
+		w.storeFailed(ctx, store, err)
+		return false
+	}
+}
+
+// pendingPurchase returns the pending standing order of a product, nil if there is none
+func (w *Worker) pendingPurchase(product string) *purchase {
+	w.purchases.lock.Lock()
+	defer w.purchases.lock.Unlock()
+	for _, p := range w.purchases.orders {
+		if p.order.Product == product {
+			return p
+		}
+	}
+	return nil
+}
+
+// OrderSettled is told by a store that a standing order of the worker is settled, through the callback of the order.
+// The callback is only a hint: the order is fetched back from the store and settled as the store has it.
+// It returns ErrOrderNotFound for an order the worker isn't waiting for, and whether the order is settled.
+func (w *Worker) OrderSettled(ctx context.Context, id string) (bool, error) {
+	w.purchases.lock.Lock()
+	p, ok := w.purchases.orders[id]
+	if ok {
+		p.checked = time.Time{} // poll it right away
+	}
+	w.purchases.lock.Unlock()
+	if !ok {
+		return false, ErrOrderNotFound
+	}
+	w.pollPurchase(ctx, p)
+
+	w.purchases.lock.Lock()
+	_, pending := w.purchases.orders[id]
+	w.purchases.lock.Unlock()
+	return !pending, nil
+}
+
+// settle settles a standing order of the worker as its store has it, from polling the store.
+// A filled order adds the products and the unused payment, a cancelled one gives the payment back.
+// It returns false for an order the worker isn't waiting for, such as one already settled,
+// or a filled order that isn't the product and quantity the worker ordered.
+func (w *Worker) settle(ctx context.Context, order Order) bool {
+	w.purchases.lock.Lock()
+	p, ok := w.purchases.orders[order.ID]
+	mismatch := ok && order.Status == OrderFilled && (order.Product != p.order.Product || order.Quantity != p.order.Quantity)
+	if ok && order.Status != OrderPending && !mismatch {
+		delete(w.purchases.orders, order.ID)
+	}
+	w.purchases.lock.Unlock()
+	if mismatch {
+		slog.WarnContext(ctx, "store filled a different order", "order", order.ID, "product", order.Product, "quantity", order.Quantity, "store", p.store)
+		return false
+	}
+	if !ok || order.Status == OrderPending {
+		return false
+	}
+
+	item := ProductInput{Product: p.order.Product, Store: p.store, Amount: p.order.Quantity}
+	switch order.Status {
+	case OrderFilled:
+		paid := min(order.Total, p.order.Payment)
+		w.deposit(p.order.Payment - paid)
+		w.addInventory(ctx, item.Product, item.Amount)
+		w.metrics.bought.WithLabelValues(item.Product).Add(float64(item.Amount))
+		w.streamEvent(StreamEvent{Kind: StreamBought, Product: item.Product, Amount: item.Amount, Total: paid})
+		slog.InfoContext(ctx, "Order delivered", "order", order.ID, "product", item.Product, "amount", item.Amount, "total", paid, "store", p.store)
+	case OrderLost:
+		w.deposit(p.order.Payment)
+		w.markDirty()
+		w.buyFailed(item, BuyFailureStatus, "order lost: "+order.Reason)
+		slog.WarnContext(ctx, "Order lost by the store", "order", order.ID, "product", item.Product, "store", p.store)
+	default:
+		w.deposit(p.order.Payment)
+		w.markDirty()
+		w.buyFailed(item, BuyFailureStatus, "order cancelled: "+order.Reason)
+		slog.InfoContext(ctx, "Order cancelled by the store", "order", order.ID, "product", item.Product, "reason", order.Reason)
+	}
+	return true
+}
+
+// withdraw takes coins out of the wallet, false when the wallet doesn't have them
+func (w *Worker) withdraw(amount int) (int, bool) {
+	w.walletLock.Lock()
+	defer w.walletLock.Unlock()
+	if amount < 0 || amount > w.wallet {
+		return 0, false
+	}
+	w.wallet -= amount
+	return amount, true
+}
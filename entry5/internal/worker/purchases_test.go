@@ -0,0 +1,65 @@
+package worker_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/server"
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+)
+
+// serve serves the REST API of the worker
+func serve(t *testing.T, w *worker.Worker) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	server.NewServer(w).InitializeREST(context.Background(), mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestDeliveryIsAHint checks that a buyer settles a standing order as its store has it, not as the callback says
+func TestDeliveryIsAHint(t *testing.T) {
+	ctx := context.Background()
+	store := worker.NewWorker("kingdom-of-foobar", "woodworker-0", []worker.Direction{{Product: "wood", Amount: 1, Interval: 1, Price: 1}}, 0, nil)
+	storeSrv := serve(t, store)
+	buyer := worker.NewWorker("kingdom-of-foobar", "craftsman-0", nil, 1000, nil)
+	buyerSrv := serve(t, buyer)
+	buyer.SetCallbackURL(buyerSrv.URL + "/api/v2/deliveries")
+
+	order, err := worker.PlaceOrderAt(buyer, ctx, worker.ProductInput{Product: "wood", Amount: 5, Standing: true}, storeSrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != worker.OrderPending {
+		t.Fatalf("order is %s, want it pending without stock", order.Status)
+	}
+	wallet := buyer.Wallet()
+
+	// a forged delivery claims the order is filled for free
+	forged, _ := json.Marshal(worker.Order{ID: order.ID, Product: "wood", Quantity: 5, Status: worker.OrderFilled})
+	resp, err := http.Post(buyerSrv.URL+"/api/v2/deliveries", "application/json", bytes.NewReader(forged))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("forged delivery got %s, want 202 Accepted while the store has the order pending", resp.Status)
+	}
+	if got := buyer.Ledger().Inventory["wood"]; got != 0 {
+		t.Fatalf("the forged delivery added %d wood", got)
+	}
+
+	// the store fills the order and calls back
+	worker.AddInventory(store, ctx, "wood", 5)
+	if got := buyer.Ledger().Inventory["wood"]; got != 5 {
+		t.Errorf("wood = %d after the store filled the order, want 5", got)
+	}
+	if buyer.Wallet() <= wallet || buyer.Wallet() >= 1000 {
+		t.Errorf("wallet = %d, want the change of the payment back and the total paid", buyer.Wallet())
+	}
+}
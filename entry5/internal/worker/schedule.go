@@ -0,0 +1,188 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/clock"
+)
+
+// InputPolicy decides which direction gets an input that several directions of a worker need
+type InputPolicy string
+
+const (
+	// InputPolicyFirstCome gives the inputs to the first direction that is due, whichever it is
+	InputPolicyFirstCome InputPolicy = "first-come"
+	// InputPolicyPriority gives the inputs to the directions in the order they are listed:
+	// a direction can't take the inputs an earlier direction is still waiting for
+	InputPolicyPriority InputPolicy = "priority"
+)
+
+// ParseInputPolicy returns the policy with the name, first-come when the name is empty
+func ParseInputPolicy(name string) (InputPolicy, error) {
+	switch policy := InputPolicy(name); policy {
+	case "":
+		return InputPolicyFirstCome, nil
+	case InputPolicyFirstCome, InputPolicyPriority:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown input policy %q, use %s or %s", name, InputPolicyFirstCome, InputPolicyPriority)
+	}
+}
+
+// DefaultLaborTime is how long a job keeps a worker busy when the schedule doesn't say
+const DefaultLaborTime = time.Second
+
+// ScheduleOptions configures how a worker runs its directions
+type ScheduleOptions struct {
+	Capacity    int           // Capacity is the number of jobs that can run at once, 0 gives every direction a slot
+	LaborTime   time.Duration // LaborTime is how long a job keeps the worker busy after buying or producing
+	InputPolicy InputPolicy   // InputPolicy decides which direction gets an input that several directions need
+}
+
+// Work runs every direction on its own goroutine and schedule until the context is canceled, and waits for them to stop.
+// A direction is due an interval after its last job finished. A job buys one missing input or produces,
+// then holds one of the capacity slots for the labor time. A due direction waits for a free slot,
+// so a direction stuck on a slow store only holds up the others once it takes the last slot.
+// On a virtual clock the directions take turns in the order they are due, the earlier one in the list on a tie,
+// so a worker on a virtual clock always makes the same moves.
+func (w *Worker) Work(ctx context.Context, opts ScheduleOptions) {
+	if len(w.directions) == 0 {
+		return
+	}
+	if opts.Capacity <= 0 || opts.Capacity > len(w.directions) {
+		opts.Capacity = len(w.directions)
+	}
+	if opts.LaborTime <= 0 {
+		opts.LaborTime = DefaultLaborTime
+	}
+	if opts.InputPolicy == "" {
+		opts.InputPolicy = InputPolicyFirstCome
+	}
+
+	s := &scheduler{
+		opts:    opts,
+		changed: make(chan struct{}),
+		starved: make([]bool, len(w.directions)),
+	}
+	var wg sync.WaitGroup
+	for i := 1; i < len(w.directions); i++ {
+		// each direction starts waiting on the clock before the next one starts, so ties are broken in list order
+		waiting := make(chan struct{})
+		clock.Go(w.clock, &wg, func() { w.runDirection(ctx, s, i, waiting) })
+		<-waiting
+	}
+	// the goroutine of Work runs the first direction itself, so it waits on the clock like the others instead of on them
+	w.runDirection(ctx, s, 0, nil)
+	wg.Wait()
+}
+
+// scheduler shares the capacity slots of a worker between its directions
+type scheduler struct {
+	opts    ScheduleOptions
+	lock    sync.Mutex
+	running int           // running is the number of jobs buying or producing
+	labor   []time.Time   // labor are when the jobs that are done free their slots, earliest first
+	changed chan struct{} // changed is closed when a running job is done, then replaced
+	starved []bool        // starved are the directions whose last job lacked inputs
+}
+
+// runDirection runs the jobs of a direction until the context is canceled.
+// The waiting channel, if any, is closed once the direction first waits on the clock.
+func (w *Worker) runDirection(ctx context.Context, s *scheduler, i int, waiting chan struct{}) {
+	direction := w.directions[i]
+	due := w.clock.Now().Add(direction.interval())
+	for {
+		if !w.sleep(ctx, due, waiting) || !w.acquire(ctx, s) {
+			return
+		}
+		waiting = nil
+
+		var keep map[string]int
+		if s.opts.InputPolicy == InputPolicyPriority {
+			s.lock.Lock()
+			keep = w.heldInputs(s.starved[:i])
+			s.lock.Unlock()
+		}
+		produced := w.produce(ctx, direction, keep)
+
+		done := w.clock.Now().Add(s.opts.LaborTime)
+		s.lock.Lock()
+		s.starved[i] = !produced
+		s.running--
+		s.labor = append(s.labor, done)
+		slices.SortFunc(s.labor, time.Time.Compare)
+		close(s.changed)
+		s.changed = make(chan struct{})
+		s.lock.Unlock()
+		due = done.Add(direction.interval())
+	}
+}
+
+// acquire waits for a free capacity slot and takes it, false when the context is canceled first
+func (w *Worker) acquire(ctx context.Context, s *scheduler) bool {
+	for {
+		now := w.clock.Now()
+		s.lock.Lock()
+		for len(s.labor) > 0 && !s.labor[0].After(now) {
+			s.labor = s.labor[1:]
+		}
+		if s.running+len(s.labor) < s.opts.Capacity {
+			s.running++
+			s.lock.Unlock()
+			return true
+		}
+		labor, changed := s.labor, s.changed
+		s.lock.Unlock()
+
+		if len(labor) > 0 {
+			// jobs that are done free their slots on the clock, a job that finishes now rests until after the earliest of them
+			if !w.sleep(ctx, labor[0], nil) {
+				return false
+			}
+			continue
+		}
+		// every slot is taken by a running job, which only happens off the virtual clock: on it a job never waits
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// sleep waits on the clock until the time, false when the context is canceled first.
+// The waiting channel, if any, is closed once the goroutine waits on the clock.
+func (w *Worker) sleep(ctx context.Context, until time.Time, waiting chan struct{}) bool {
+	after := w.clock.After(max(until.Sub(w.clock.Now()), 0))
+	if waiting != nil {
+		close(waiting)
+	}
+	select {
+	case <-after:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// heldInputs returns the inputs the starved directions are waiting for, which no other direction may take
+func (w *Worker) heldInputs(starved []bool) map[string]int {
+	held := make(map[string]int)
+	for i, waiting := range starved {
+		if !waiting {
+			continue
+		}
+		for _, input := range w.directions[i].ProductInputList {
+			held[input.Product] += input.Amount
+		}
+	}
+	return held
+}
+
+func (d Direction) interval() time.Duration {
+	return time.Duration(d.Interval) * time.Second
+}
@@ -0,0 +1,262 @@
+package worker
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Strategy picks the store an input is bought from first. The other stores follow when the first can't sell.
+type Strategy string
+
+const (
+	StrategyFirstInStock Strategy = "first-in-stock" // the stores in the order they are listed, discovered stores last
+	StrategyCheapest     Strategy = "cheapest"       // the store with the lowest price for the product
+	StrategyNearest      Strategy = "nearest"        // the store that answered fastest so far
+	StrategyRoundRobin   Strategy = "round-robin"    // every store in turn
+)
+
+// Circuit breaker of a store: after breakerThreshold failures in a row the store is skipped for breakerBackoff,
+// doubling every time a retry fails too, up to breakerMaxBackoff
+const (
+	breakerThreshold  = 3
+	breakerBackoff    = 5 * time.Second
+	breakerMaxBackoff = 2 * time.Minute
+)
+
+// storeTimeout is how long a single request to a store may take. A store that doesn't answer in time counts as a failure of its breaker.
+var storeTimeout = 10 * time.Second
+
+// Discovery finds the stores of the kingdom that make a product, for the inputs that discover their stores
+type Discovery interface {
+	Stores(ctx context.Context, product string) ([]string, error)
+}
+
+// SetDiscovery makes the worker find stores through the discovery
+func (w *Worker) SetDiscovery(discovery Discovery) {
+	w.discovery = discovery
+}
+
+// validStrategy reports whether the strategy is known, empty is first-in-stock
+func validStrategy(strategy Strategy) bool {
+	switch strategy {
+	case "", StrategyFirstInStock, StrategyCheapest, StrategyNearest, StrategyRoundRobin:
+		return true
+	}
+	return false
+}
+
+// sourcing is what a worker remembers about the stores it buys from
+type sourcing struct {
+	lock     sync.Mutex
+	breakers map[string]*breaker
+	latency  map[string]time.Duration // latency is the moving average of the answer time of each store
+	turns    map[string]int           // turns is the next store of every round-robin product
+}
+
+func newSourcing() *sourcing {
+	return &sourcing{
+		breakers: make(map[string]*breaker),
+		latency:  make(map[string]time.Duration),
+		turns:    make(map[string]int),
+	}
+}
+
+// breaker is the circuit breaker of a single store
+type breaker struct {
+	failures  int       // failures is the number of failures in a row
+	opened    int       // opened is the number of times the circuit opened in a row, for the backoff
+	openUntil time.Time // openUntil is when the store may be tried again
+}
+
+// source buys the input from the first store that sells it, in the order of its strategy.
+// Stores with an open circuit are skipped. It returns whether the input was bought.
+func (w *Worker) source(ctx context.Context, input ProductInput) bool {
+	stores := w.stores(ctx, input)
+	if len(stores) == 0 {
+		w.buyFailed(input, BuyFailureNoStore, "no store sells it")
+		return false
+	}
+	stores = w.order(ctx, input, stores)
+	if input.Standing {
+		return w.sourceStanding(ctx, input, stores)
+	}
+	for _, store := range stores {
+		if !w.sourcing.allow(store, w.clock.Now()) {
+			slog.DebugContext(ctx, "skipping store with an open circuit", "store", store, "product", input.Product)
+			continue
+		}
+		item := input
+		item.Store = store
+		start := w.clock.Now()
+		attemptCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+		err := w.buy(attemptCtx, item)
+		cancel()
+		w.sourcing.observe(store, w.clock.Now().Sub(start))
+		if err == nil {
+			w.sourcing.succeeded(store)
+			return true
+		}
+		if errors.Is(err, ErrNotEnoughInventory) || errors.Is(err, ErrInsufficientPayment) || errors.Is(err, ErrUnknownProduct) {
+			w.sourcing.succeeded(store) // the store is up, it only turned the sale down
+			continue
+		}
+		if ctx.Err() != nil {
+			return false // the worker is stopping, that is not the fault of the store
+		}
+		w.storeFailed(ctx, store, err)
+	}
+	return false
+}
+
+// stores returns every store the input can be bought from, without duplicates
+func (w *Worker) stores(ctx context.Context, input ProductInput) []string {
+	var stores []string
+	if input.Store != "" {
+		stores = append(stores, input.Store)
+	}
+	stores = append(stores, input.Stores...)
+	if input.Discover && w.discovery != nil {
+		discovered, err := w.discovery.Stores(ctx, input.Product)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to discover stores", "product", input.Product, "error", err)
+		}
+		stores = append(stores, discovered...)
+	}
+	var unique []string
+	for _, store := range stores {
+		if !slices.Contains(unique, store) {
+			unique = append(unique, store)
+		}
+	}
+	return unique
+}
+
+// order sorts the stores in the order the strategy of the input tries them
+func (w *Worker) order(ctx context.Context, input ProductInput, stores []string) []string {
+	switch input.Strategy {
+	case StrategyCheapest:
+		prices := make(map[string]int, len(stores))
+		for _, store := range stores {
+			prices[store] = math.MaxInt // stores without a price go last
+			if !w.sourcing.allow(store, w.clock.Now()) {
+				continue
+			}
+			priceCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+			price, err := w.price(priceCtx, store, input.Product)
+			cancel()
+			if err != nil {
+				w.storeFailed(ctx, store, err)
+				continue
+			}
+			prices[store] = price
+		}
+		slices.SortStableFunc(stores, func(a, b string) int { return cmp.Compare(prices[a], prices[b]) })
+	case StrategyNearest:
+		latency := w.sourcing.latencies(stores)
+		slices.SortStableFunc(stores, func(a, b string) int { return cmp.Compare(latency[a], latency[b]) })
+	case StrategyRoundRobin:
+		turn := w.sourcing.turn(input.Product) % len(stores)
+		stores = slices.Concat(stores[turn:], stores[:turn])
+	}
+	return stores
+}
+
+// price asks a store for its price of the product
+func (w *Worker) price(ctx context.Context, store, product string) (int, error) {
+	client, err := w.storeClient(store)
+	if err != nil {
+		return 0, err
+	}
+	prices, err := client.Prices(ctx)
+	if err != nil {
+		return 0, err
+	}
+	price, ok := prices[product]
+	if !ok {
+		return math.MaxInt, nil // the store has no price for it, try it last
+	}
+	return price, nil
+}
+
+// storeFailed counts a failure of the store, recording an event when its circuit opens
+func (w *Worker) storeFailed(ctx context.Context, store string, err error) {
+	backoff, opened := w.sourcing.failed(store, w.clock.Now())
+	if !opened {
+		return
+	}
+	w.metrics.circuitOpened.WithLabelValues(store).Inc()
+	w.events.Event(EventTypeWarning, ReasonStoreUnavailable,
+		fmt.Sprintf("%s keeps failing, skipping it for %s: %v", store, backoff, err))
+	slog.WarnContext(ctx, "store is unavailable, skipping it", "store", store, "backoff", backoff, "error", err)
+}
+
+// allow reports whether the store may be tried: its circuit is closed, or its backoff is over
+func (s *sourcing) allow(store string, now time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b, ok := s.breakers[store]
+	return !ok || b.failures < breakerThreshold || !now.Before(b.openUntil)
+}
+
+func (s *sourcing) succeeded(store string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.breakers, store)
+}
+
+// failed counts a failure of the store. It returns the backoff and true when the circuit opens,
+// either after too many failures in a row or because the retry after a backoff failed.
+func (s *sourcing) failed(store string, now time.Time) (time.Duration, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b, ok := s.breakers[store]
+	if !ok {
+		b = &breaker{}
+		s.breakers[store] = b
+	}
+	b.failures++
+	if b.failures < breakerThreshold {
+		return 0, false
+	}
+	backoff := min(breakerBackoff<<min(b.opened, 16), breakerMaxBackoff)
+	b.opened++
+	b.openUntil = now.Add(backoff)
+	return backoff, true
+}
+
+// observe adds an answer time of the store to its moving average
+func (s *sourcing) observe(store string, latency time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if previous, ok := s.latency[store]; ok {
+		latency = (previous*4 + latency) / 5
+	}
+	s.latency[store] = latency
+}
+
+// latencies returns the moving average of the stores, stores never tried first
+func (s *sourcing) latencies(stores []string) map[string]time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	latency := make(map[string]time.Duration, len(stores))
+	for _, store := range stores {
+		latency[store] = s.latency[store]
+	}
+	return latency
+}
+
+// turn returns the turn of the product and moves it to the next store
+func (s *sourcing) turn(product string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	turn := s.turns[product]
+	s.turns[product]++
+	return turn
+}
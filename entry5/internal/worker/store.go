@@ -0,0 +1,345 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
+	"k8s.io/client-go/util/retry"
+)
+
+// Ledger is everything a worker owns: its inventory and the coins in its wallet
+type Ledger struct {
+	Inventory map[string]int `json:"inventory"`
+	Wallet    int            `json:"wallet"`
+	Prices    map[string]int `json:"prices,omitempty"`   // Prices are published for watchers, they are never restored
+	Rejected  map[string]int `json:"rejected,omitempty"` // Rejected are the units refused for lack of stock, published for the autoscaler and never restored
+
+	LastProduced map[string]time.Time `json:"lastProduced,omitempty"` // LastProduced is when each product was last made, published for watchers and never restored
+}
+
+// InventoryStore persists the ledger of a worker so it survives restarts
+type InventoryStore interface {
+	// Load returns the last saved ledger, or nil if nothing was saved
+	Load(ctx context.Context) (*Ledger, error)
+	// Save persists the ledger
+	Save(ctx context.Context, ledger Ledger) error
+}
+
+// AnnotationStore keeps the inventory in the civ.k8s-research/inventory annotation of the worker's pod.
+// Annotations survive container restarts but not new pods from a rollout.
+type AnnotationStore struct {
+	client    *k8s.Client
+	namespace string
+	pod       string
+	sequence  atomic.Int64 // sequence is the sequence number of the last document saved
+	resume    sync.Once    // resume reads the sequence of the pod once, when the store is not the one loaded from
+}
+
+func NewAnnotationStore(client *k8s.Client, namespace, pod string) *AnnotationStore {
+	return &AnnotationStore{
+		client:    client,
+		namespace: namespace,
+		pod:       pod,
+	}
+}
+
+func (s *AnnotationStore) Load(ctx context.Context) (*Ledger, error) {
+	annotations, err := s.client.GetPodAnnotations(ctx, s.namespace, s.pod)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := k8s.DecodeInventoryAnnotation(annotations)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, nil // the worker never saved its ledger to this pod
+	}
+	s.resume.Do(func() { s.sequence.Store(doc.Sequence) })
+	return &Ledger{
+		Inventory: doc.Inventory,
+		Wallet:    doc.Wallet,
+	}, nil
+}
+
+func (s *AnnotationStore) Save(ctx context.Context, ledger Ledger) error {
+	// keep counting from the last document on the pod, so watchers don't drop the next one as stale
+	s.resume.Do(func() {
+		annotations, err := s.client.GetPodAnnotations(ctx, s.namespace, s.pod)
+		if err != nil {
+			return
+		}
+		if doc, err := k8s.DecodeInventoryAnnotation(annotations); err == nil && doc != nil {
+			s.sequence.Store(doc.Sequence)
+		}
+	})
+
+	annotations, err := k8s.EncodeInventoryAnnotation(k8s.InventoryDocument{
+		Sequence:     s.sequence.Add(1),
+		Inventory:    ledger.Inventory,
+		Wallet:       ledger.Wallet,
+		Prices:       ledger.Prices,
+		Rejected:     ledger.Rejected,
+		LastProduced: ledger.LastProduced,
+	})
+	if err != nil {
+		return err
+	}
+	return s.client.PatchPod(ctx, s.namespace, s.pod, annotations)
+}
+
+// Handover is implemented by stores that pass the ledger of a stopping worker on to another worker of the same shop
+type Handover interface {
+	// Release gives up the ledger of the worker, for another worker to claim
+	Release(ctx context.Context) error
+	// Claim takes over a released ledger and saves it together with the ledger of the worker. It returns nil if none was released.
+	Claim(ctx context.Context) (*Ledger, error)
+}
+
+// releasedPrefix marks the keys of a ConfigMapStore whose worker released its ledger on shutdown
+const releasedPrefix = "released."
+
+// ConfigMapStore keeps the inventory of every worker of a shop in a ConfigMap named <shop>-inventory.
+// Each worker owns the key of its pod name. A stopping worker renames its key to released.<pod>,
+// and the next worker of the shop claims it, so the inventory survives rollouts as well as restarts.
+// Every change is a compare-and-swap on the resourceVersion, so two workers never claim the same ledger.
+type ConfigMapStore struct {
+	client    *k8s.Client
+	namespace string
+	shop      string
+	pod       string
+}
+
+func NewConfigMapStore(client *k8s.Client, namespace, shop, pod string) *ConfigMapStore {
+	return &ConfigMapStore{
+		client:    client,
+		namespace: namespace,
+		shop:      shop,
+		pod:       pod,
+	}
+}
+
+func (s *ConfigMapStore) name() string {
+	return s.shop + "-inventory"
+}
+
+func (s *ConfigMapStore) labels() map[string]string {
+	return map[string]string{k8s.ShopLabel: s.shop}
+}
+
+// Load returns the ledger of the pod after a restart. A new pod claims a released ledger instead,
+// the key of a pod that is gone without releasing it (a crash, a lost node) is left alone.
+func (s *ConfigMapStore) Load(ctx context.Context) (*Ledger, error) {
+	data, _, err := s.client.GetConfigMapData(ctx, s.namespace, s.name())
+	if err != nil {
+		return nil, err
+	}
+	if saved, ok := data[s.pod]; ok {
+		var ledger Ledger
+		if err := json.Unmarshal([]byte(saved), &ledger); err != nil {
+			return nil, fmt.Errorf("error decoding inventory of %s: %w", s.pod, err)
+		}
+		return &ledger, nil
+	}
+	return s.Claim(ctx)
+}
+
+func (s *ConfigMapStore) Save(ctx context.Context, ledger Ledger) error {
+	encoded, err := json.Marshal(ledger)
+	if err != nil {
+		return err
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		data, resourceVersion, err := s.client.GetConfigMapData(ctx, s.namespace, s.name())
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			data = make(map[string]string)
+		}
+		data[s.pod] = string(encoded)
+		return s.client.SaveConfigMapData(ctx, s.namespace, s.name(), s.labels(), data, resourceVersion)
+	})
+}
+
+// Release renames the key of the pod to released.<pod>, for the worker replacing it to claim
+func (s *ConfigMapStore) Release(ctx context.Context) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		data, resourceVersion, err := s.client.GetConfigMapData(ctx, s.namespace, s.name())
+		if err != nil {
+			return err
+		}
+		saved, ok := data[s.pod]
+		if !ok {
+			return nil // nothing was saved
+		}
+		data[releasedPrefix+s.pod] = saved
+		delete(data, s.pod)
+		return s.client.SaveConfigMapData(ctx, s.namespace, s.name(), s.labels(), data, resourceVersion)
+	})
+}
+
+// Claim moves the oldest released ledger into the key of the pod, adding it to the ledger saved there
+func (s *ConfigMapStore) Claim(ctx context.Context) (*Ledger, error) {
+	var claimed *Ledger
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		claimed = nil
+		data, resourceVersion, err := s.client.GetConfigMapData(ctx, s.namespace, s.name())
+		if err != nil {
+			return err
+		}
+		for _, key := range slices.Sorted(maps.Keys(data)) {
+			if !strings.HasPrefix(key, releasedPrefix) {
+				continue
+			}
+			var released Ledger
+			if err := json.Unmarshal([]byte(data[key]), &released); err != nil {
+				return fmt.Errorf("error decoding inventory of %s: %w", key, err)
+			}
+			merged := released
+			if saved, ok := data[s.pod]; ok {
+				var own Ledger
+				if err := json.Unmarshal([]byte(saved), &own); err != nil {
+					return fmt.Errorf("error decoding inventory of %s: %w", s.pod, err)
+				}
+				merged = mergeLedgers(own, released)
+			}
+			encoded, err := json.Marshal(merged)
+			if err != nil {
+				return err
+			}
+			data[s.pod] = string(encoded)
+			delete(data, key)
+			if err := s.client.SaveConfigMapData(ctx, s.namespace, s.name(), s.labels(), data, resourceVersion); err != nil {
+				return err
+			}
+			claimed = &released
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// mergeLedgers adds the inventory and the wallet of two ledgers
+func mergeLedgers(a, b Ledger) Ledger {
+	merged := Ledger{Inventory: maps.Clone(a.Inventory), Wallet: a.Wallet + b.Wallet}
+	if merged.Inventory == nil {
+		merged.Inventory = make(map[string]int)
+	}
+	for product, amount := range b.Inventory {
+		merged.Inventory[product] += amount
+	}
+	return merged
+}
+
+// FileStore keeps the inventory in a json file, usually on a volume mounted into the worker
+type FileStore struct {
+	path string
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (s *FileStore) Load(ctx context.Context) (*Ledger, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading inventory file: %w", err)
+	}
+	var ledger Ledger
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return nil, fmt.Errorf("error decoding inventory file: %w", err)
+	}
+	return &ledger, nil
+}
+
+func (s *FileStore) Save(ctx context.Context, ledger Ledger) error {
+	data, err := json.Marshal(ledger)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file and rename it so a crash never leaves a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".inventory-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// MultiStore saves to every store and loads from the first store that has a ledger.
+// It lets a worker persist to a ConfigMap or file while still publishing to its pod annotations.
+type MultiStore []InventoryStore
+
+func (m MultiStore) Load(ctx context.Context) (*Ledger, error) {
+	var errs []error
+	for _, store := range m {
+		ledger, err := store.Load(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ledger != nil {
+			return ledger, nil
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (m MultiStore) Save(ctx context.Context, ledger Ledger) error {
+	var errs []error
+	for _, store := range m {
+		if err := store.Save(ctx, ledger); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Release releases the ledger of every store that hands ledgers over
+func (m MultiStore) Release(ctx context.Context) error {
+	var errs []error
+	for _, store := range m {
+		if handover, ok := store.(Handover); ok {
+			if err := handover.Release(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Claim claims a ledger from the first store that hands ledgers over
+func (m MultiStore) Claim(ctx context.Context) (*Ledger, error) {
+	for _, store := range m {
+		if handover, ok := store.(Handover); ok {
+			return handover.Claim(ctx)
+		}
+	}
+	return nil, nil
+}
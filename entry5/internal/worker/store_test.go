@@ -0,0 +1,109 @@
+package worker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestClient returns a client on a fake clientset with an empty inventory ConfigMap.
+// The fake clientset doesn't set resource versions, the ConfigMap gets one so saves update it.
+func newTestClient() *k8s.Client {
+	return k8s.NewClientFromInterface(fake.NewClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "woodworker-inventory", Namespace: "kingdom-of-foobar", ResourceVersion: "1"},
+	}), "kingdom-of-foobar")
+}
+
+func TestConfigMapStoreHandover(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient()
+	old := NewConfigMapStore(client, "kingdom-of-foobar", "woodworker", "woodworker-a-1")
+	surge := NewConfigMapStore(client, "kingdom-of-foobar", "woodworker", "woodworker-b-1")
+
+	if err := old.Save(ctx, Ledger{Inventory: map[string]int{"wood": 10}, Wallet: 500}); err != nil {
+		t.Fatal(err)
+	}
+	// the surge pod starts while the old one still runs, it must not take the ledger
+	ledger, err := surge.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ledger != nil {
+		t.Fatalf("surge pod loaded %+v before the old pod released it", ledger)
+	}
+	if err := surge.Save(ctx, Ledger{Inventory: map[string]int{"wood": 1}, Wallet: 1000}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := old.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := surge.Claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed == nil || claimed.Inventory["wood"] != 10 || claimed.Wallet != 500 {
+		t.Fatalf("claimed %+v, want the released ledger", claimed)
+	}
+	saved, err := surge.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Inventory["wood"] != 11 || saved.Wallet != 1500 {
+		t.Errorf("saved %+v, want both ledgers added", saved)
+	}
+	if again, err := NewConfigMapStore(client, "kingdom-of-foobar", "woodworker", "woodworker-c-1").Claim(ctx); err != nil || again != nil {
+		t.Errorf("claimed %+v, %v a second time", again, err)
+	}
+}
+
+func TestConfigMapStoreLoadClaimsReleased(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient()
+	old := NewConfigMapStore(client, "kingdom-of-foobar", "woodworker", "woodworker-a-1")
+	if err := old.Save(ctx, Ledger{Inventory: map[string]int{"wood": 3}, Wallet: 42}); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	ledger, err := NewConfigMapStore(client, "kingdom-of-foobar", "woodworker", "woodworker-b-1").Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ledger == nil || ledger.Inventory["wood"] != 3 || ledger.Wallet != 42 {
+		t.Errorf("loaded %+v, want the released ledger", ledger)
+	}
+}
+
+func TestClaimReleasedGivesBackStartingCoins(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient()
+	old := NewConfigMapStore(client, "kingdom-of-foobar", "woodworker", "woodworker-a-1")
+	if err := old.Save(ctx, Ledger{Inventory: map[string]int{"wood": 5}, Wallet: 300}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewConfigMapStore(client, "kingdom-of-foobar", "woodworker", "woodworker-b-1")
+	w := NewWorker("kingdom-of-foobar", "woodworker-b-1", []Direction{{Product: "wood", Amount: 1, Interval: 1}}, 1000, store)
+	if err := w.Restore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.claimReleased(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Wallet(); got != 300 {
+		t.Errorf("wallet = %d, want the 300 coins handed over instead of the 1000 starting coins", got)
+	}
+	if got := w.Ledger().Inventory["wood"]; got != 5 {
+		t.Errorf("wood = %d, want 5", got)
+	}
+}
@@ -0,0 +1,131 @@
+package worker
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Kinds of stream events
+const (
+	StreamInventory = "inventory" // the stock of a product changed
+	StreamProduced  = "produced"  // the worker made a product
+	StreamSold      = "sold"      // the worker sold to a buyer, on the spot or through an order
+	StreamBought    = "bought"    // the worker bought an input from a store
+)
+
+// streamSize is the number of events a worker keeps for streams that resume
+const streamSize = 1024
+
+// StreamEvent is a change of a worker, as sent on /events
+type StreamEvent struct {
+	ID      uint64    `json:"id"` // ID increases by one with every event, it starts over with a new stream instance
+	Kind    string    `json:"kind"`
+	Time    time.Time `json:"time"`
+	Product string    `json:"product"`
+	Amount  int       `json:"amount"`          // Amount is the change of the stock for inventory events, the units made, sold or bought otherwise
+	Stock   int       `json:"stock"`           // Stock is the units of the product on hand after the event
+	Total   int       `json:"total,omitempty"` // Total is the coins paid for a sale or a purchase
+	Wallet  int       `json:"wallet"`          // Wallet is the coins of the worker after the event
+}
+
+// stream keeps the latest events of a worker in a ring buffer and wakes the readers on new ones
+type stream struct {
+	instance string // instance tells the streams of a restarted worker apart, whose IDs start over
+	lock     sync.Mutex
+	events   []StreamEvent // events is the ring buffer, events[start] is the oldest event once it is full
+	start    int
+	last     uint64        // last is the ID of the newest event
+	notify   chan struct{} // notify is closed on the next event
+}
+
+func newStream() *stream {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return &stream{
+		instance: hex.EncodeToString(b),
+		events:   make([]StreamEvent, 0, streamSize),
+		notify:   make(chan struct{}),
+	}
+}
+
+// publish adds an event with the next ID, dropping the oldest one when the buffer is full
+func (s *stream) publish(event StreamEvent) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.last++
+	event.ID = s.last
+	if len(s.events) < streamSize {
+		s.events = append(s.events, event)
+	} else {
+		s.events[s.start] = event
+		s.start = (s.start + 1) % streamSize
+	}
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// since returns the events after the ID, oldest first, and a channel closed on the next event.
+// It returns false when events after the ID were dropped, or the ID is from before a restart.
+func (s *stream) since(id uint64) ([]StreamEvent, <-chan struct{}, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if id > s.last {
+		return nil, s.notify, false
+	}
+	if len(s.events) == 0 || id == s.last {
+		return nil, s.notify, true
+	}
+	oldest := s.events[s.start].ID
+	complete := id+1 >= oldest
+	skip := 0
+	if complete {
+		skip = int(id + 1 - oldest)
+	}
+	events := make([]StreamEvent, 0, len(s.events)-skip)
+	for i := skip; i < len(s.events); i++ {
+		events = append(events, s.events[(s.start+i)%len(s.events)])
+	}
+	return events, s.notify, complete
+}
+
+// Stream returns the events after the ID and a channel closed on the next event, for /events.
+// It returns false when it can't resume from the ID, the events it has are then all it kept
+// and the reader should start over from the Ledger.
+func (w *Worker) Stream(after uint64) ([]StreamEvent, <-chan struct{}, bool) {
+	return w.stream.since(after)
+}
+
+// StreamInstance returns the instance of the stream, a resumed stream must come from the same instance
+func (w *Worker) StreamInstance() string {
+	return w.stream.instance
+}
+
+// LastEventID returns the ID of the newest event of the stream, 0 before the first event
+func (w *Worker) LastEventID() uint64 {
+	w.stream.lock.Lock()
+	defer w.stream.lock.Unlock()
+	return w.stream.last
+}
+
+// streamInventory publishes the changes of the stock, one event for each product.
+// The sign turns the amounts into changes: 1 for items added, -1 for items taken out.
+func (w *Worker) streamInventory(items map[string]int, sign int) {
+	for _, product := range slices.Sorted(maps.Keys(items)) {
+		if items[product] == 0 {
+			continue
+		}
+		w.streamEvent(StreamEvent{Kind: StreamInventory, Product: product, Amount: sign * items[product]})
+	}
+}
+
+// streamEvent publishes an event, filling in the time, the stock of its product and the wallet
+func (w *Worker) streamEvent(event StreamEvent) {
+	event.Time = w.clock.Now()
+	event.Stock = w.inventory.Amount(event.Product)
+	event.Wallet = w.Wallet()
+	w.stream.publish(event)
+}
@@ -0,0 +1,80 @@
+package worker_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/server"
+	"github.com/Potokar1/k8s-research/entry5/internal/tracing"
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// ledgerStore restores a fixed ledger and drops every save
+type ledgerStore struct {
+	ledger worker.Ledger
+}
+
+func (s ledgerStore) Load(ctx context.Context) (*worker.Ledger, error) {
+	return &s.ledger, nil
+}
+
+func (s ledgerStore) Save(ctx context.Context, ledger worker.Ledger) error {
+	return nil
+}
+
+// TestBuyTrace checks that a buy and the sale it causes at the store are one trace
+func TestBuyTrace(t *testing.T) {
+	ctx := context.Background()
+	shutdown, err := tracing.Setup(ctx, tracing.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(ctx)
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	store := worker.NewWorker("kingdom-of-foobar", "woodworker-0", []worker.Direction{{Product: "wood", Amount: 1, Interval: 1, Price: 1}}, 0,
+		ledgerStore{worker.Ledger{Inventory: map[string]int{"wood": 10}}})
+	if err := store.Restore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	server.NewServer(store).InitializeREST(ctx, mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	buyer := worker.NewWorker("kingdom-of-foobar", "craftsman-0", nil, 1000, nil)
+	if err := worker.Buy(buyer, ctx, worker.ProductInput{Product: "wood", Amount: 2, Store: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.ForceFlush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	buy, ok := spans["Worker.buy"]
+	if !ok {
+		t.Fatalf("no Worker.buy span in %v", exporter.GetSpans().Snapshots())
+	}
+	sell, ok := spans["Server.restSell"]
+	if !ok {
+		t.Fatalf("no Server.restSell span in %v", exporter.GetSpans().Snapshots())
+	}
+	if buy.SpanContext.TraceID() != sell.SpanContext.TraceID() {
+		t.Errorf("Worker.buy is in trace %s, Server.restSell in %s", buy.SpanContext.TraceID(), sell.SpanContext.TraceID())
+	}
+	if sell.Parent.SpanID() != buy.SpanContext.SpanID() {
+		t.Errorf("Server.restSell has parent %s, want Worker.buy %s", sell.Parent.SpanID(), buy.SpanContext.SpanID())
+	}
+}
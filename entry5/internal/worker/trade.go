@@ -0,0 +1,219 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/auth"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrStoreStatus is wrapped by the errors of a store that answered, but not with what was asked for
+var ErrStoreStatus = errors.New("store answered with an error")
+
+// StoreClient trades with a single store. Its errors tell a store that turned the trade down
+// (ErrNotEnoughInventory, ErrInsufficientPayment, ErrUnknownProduct, ErrOrderNotFound) from one that answered wrong (ErrStoreStatus),
+// any other error is a store that could not be reached.
+type StoreClient interface {
+	// Sell buys the products from the store right away, the payment is the most the worker pays
+	Sell(ctx context.Context, product string, quantity, payment int) (Receipt, error)
+	// Prices returns the price of every product the store makes
+	Prices(ctx context.Context) (map[string]int, error)
+	// PlaceOrder places a standing order with the store, which calls back when it is settled
+	PlaceOrder(ctx context.Context, product string, quantity, payment int, callback string) (Order, error)
+	// Order returns a standing order placed with the store
+	Order(ctx context.Context, id string) (Order, error)
+}
+
+// storeClients are the clients of the stores of a worker by URL, so gRPC stores keep their connection
+type storeClients struct {
+	lock    sync.Mutex
+	clients map[string]StoreClient
+	dialer  func(ctx context.Context, address string) (net.Conn, error) // dialer connects to gRPC stores, nil dials TCP
+	tokens  *auth.TokenFile                                             // tokens is the service account token sent to the stores, nil sends none
+}
+
+// SetGRPCDialer makes the worker connect to grpc:// stores through the dialer, such as in-memory connections
+func (w *Worker) SetGRPCDialer(dialer func(ctx context.Context, address string) (net.Conn, error)) {
+	w.storeClients.lock.Lock()
+	defer w.storeClients.lock.Unlock()
+	w.storeClients.dialer = dialer
+}
+
+// SetTokenFile makes the worker send its service account token to the stores it buys from, so they know which shop buys
+func (w *Worker) SetTokenFile(tokens *auth.TokenFile) {
+	w.storeClients.lock.Lock()
+	defer w.storeClients.lock.Unlock()
+	w.storeClients.tokens = tokens
+}
+
+// storeClient returns the client of a store: gRPC for grpc://ironworker, HTTP for every other URL
+func (w *Worker) storeClient(store string) (StoreClient, error) {
+	w.storeClients.lock.Lock()
+	defer w.storeClients.lock.Unlock()
+	if client, ok := w.storeClients.clients[store]; ok {
+		return client, nil
+	}
+	u, err := url.Parse(store)
+	if err != nil {
+		return nil, err
+	}
+	var client StoreClient
+	if u.Scheme == "grpc" {
+		if client, err = newGRPCStore(u, w.storeClients.dialer, w.storeClients.tokens); err != nil {
+			return nil, err
+		}
+	} else {
+		client = &httpStore{client: w.client, url: store, tokens: w.storeClients.tokens}
+	}
+	w.storeClients.clients[store] = client
+	return client, nil
+}
+
+// httpStore trades with a store through its REST API
+type httpStore struct {
+	client *http.Client
+	url    string
+	tokens *auth.TokenFile
+}
+
+func (s *httpStore) Sell(ctx context.Context, product string, quantity, payment int) (Receipt, error) {
+	payload, err := json.Marshal(BuyRequest{
+		Item:     product,
+		Quantity: quantity,
+		Payment:  payment,
+	})
+	if err != nil {
+		return Receipt{}, err
+	}
+	resp, err := s.do(ctx, http.MethodPost, "/sell", payload)
+	if err != nil {
+		return Receipt{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// the store charged us for the item, keep the change
+		var receipt Receipt
+		if err := json.NewDecoder(resp.Body).Decode(&receipt); err != nil {
+			return Receipt{}, fmt.Errorf("%w: bad receipt: %v", ErrStoreStatus, err)
+		}
+		return receipt, nil
+	case http.StatusConflict:
+		// Conflict means the store could not fulfill the request due to insufficient inventory
+		return Receipt{}, ErrNotEnoughInventory
+	case http.StatusPaymentRequired:
+		// Payment Required means the store charges more than the worker can afford
+		return Receipt{}, ErrInsufficientPayment
+	case http.StatusNotFound:
+		// Not Found means the store does not make the product
+		return Receipt{}, ErrUnknownProduct
+	default:
+		return Receipt{}, fmt.Errorf("%w: %s", ErrStoreStatus, resp.Status)
+	}
+}
+
+func (s *httpStore) Prices(ctx context.Context) (map[string]int, error) {
+	resp, err := s.do(ctx, http.MethodGet, "/prices", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrStoreStatus, resp.Status)
+	}
+	var prices map[string]int
+	if err := json.NewDecoder(resp.Body).Decode(&prices); err != nil {
+		return nil, fmt.Errorf("%w: bad prices: %v", ErrStoreStatus, err)
+	}
+	return prices, nil
+}
+
+func (s *httpStore) PlaceOrder(ctx context.Context, product string, quantity, payment int, callback string) (Order, error) {
+	payload, err := json.Marshal(map[string]any{
+		"product":  product,
+		"quantity": quantity,
+		"payment":  payment,
+		"standing": true,
+		"callback": callback,
+	})
+	if err != nil {
+		return Order{}, err
+	}
+	resp, err := s.do(ctx, http.MethodPost, "/api/v2/orders", payload)
+	if err != nil {
+		return Order{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusAccepted:
+		return decodeOrder(resp)
+	case http.StatusPaymentRequired:
+		return Order{}, ErrInsufficientPayment
+	case http.StatusNotFound, http.StatusUnprocessableEntity:
+		return Order{}, ErrUnknownProduct
+	case http.StatusTooManyRequests:
+		return Order{}, ErrTooManyOrders
+	default:
+		return Order{}, fmt.Errorf("%w: %s", ErrStoreStatus, resp.Status)
+	}
+}
+
+func (s *httpStore) Order(ctx context.Context, id string) (Order, error) {
+	resp, err := s.do(ctx, http.MethodGet, "/api/v2/orders/"+url.PathEscape(id), nil)
+	if err != nil {
+		return Order{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return decodeOrder(resp)
+	case http.StatusNotFound:
+		return Order{}, ErrOrderNotFound
+	default:
+		return Order{}, fmt.Errorf("%w: %s", ErrStoreStatus, resp.Status)
+	}
+}
+
+// do sends a request to the store, with a json body when there is one, and carries the trace along
+func (s *httpStore) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token := s.tokens.Token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	// carry the trace to the store, so its side shows up under this call
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	return resp, nil
+}
+
+func decodeOrder(resp *http.Response) (Order, error) {
+	var order Order
+	if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
+		return Order{}, fmt.Errorf("%w: bad order: %v", ErrStoreStatus, err)
+	}
+	return order, nil
+}
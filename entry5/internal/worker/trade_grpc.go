@@ -0,0 +1,190 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	shopv1 "github.com/Potokar1/k8s-research/entry5/internal/apis/shop/v1"
+	"github.com/Potokar1/k8s-research/entry5/internal/auth"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// DefaultGRPCPort is the port of the Shop service, for grpc:// stores without a port
+const DefaultGRPCPort = "9090"
+
+// A RESOURCE_EXHAUSTED status is a store out of stock, unless its ErrorInfo detail has the reason ReasonTooManyOrders
+const (
+	GRPCErrorDomain     = "civ.shop.v1"
+	ReasonTooManyOrders = "TOO_MANY_ORDERS"
+)
+
+// grpcStore trades with a store through its Shop service
+type grpcStore struct {
+	client shopv1.ShopClient
+}
+
+// newGRPCStore connects to the store of a grpc:// URL. The connection is made on the first call and kept.
+// Without a dialer the address is resolved through DNS, with one the dialer gets the address as it is.
+func newGRPCStore(u *url.URL, dialer func(ctx context.Context, address string) (net.Conn, error), tokens *auth.TokenFile) (*grpcStore, error) {
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), DefaultGRPCPort)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if dialer != nil {
+		address = "passthrough:///" + address
+		opts = append(opts, grpc.WithContextDialer(dialer))
+	}
+	if tokens != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokens))
+	}
+	conn, err := grpc.NewClient(address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcStore{client: shopv1.NewShopClient(conn)}, nil
+}
+
+func (s *grpcStore) Sell(ctx context.Context, product string, quantity, payment int) (Receipt, error) {
+	resp, err := s.client.Sell(ctx, &shopv1.SellRequest{
+		Product:  product,
+		Quantity: int64(quantity),
+		Payment:  int64(payment),
+	})
+	if err != nil {
+		return Receipt{}, grpcError(err, ErrUnknownProduct)
+	}
+	return Receipt{
+		Item:     resp.Product,
+		Quantity: int(resp.Quantity),
+		Price:    int(resp.Price),
+		Total:    int(resp.Total),
+	}, nil
+}
+
+func (s *grpcStore) Prices(ctx context.Context) (map[string]int, error) {
+	resp, err := s.client.GetInventory(ctx, &shopv1.GetInventoryRequest{})
+	if err != nil {
+		return nil, grpcError(err, nil)
+	}
+	prices := make(map[string]int)
+	for _, item := range resp.Items {
+		if item.Price > 0 {
+			prices[item.Product] = int(item.Price)
+		}
+	}
+	return prices, nil
+}
+
+func (s *grpcStore) PlaceOrder(ctx context.Context, product string, quantity, payment int, callback string) (Order, error) {
+	resp, err := s.client.PlaceOrder(ctx, &shopv1.PlaceOrderRequest{
+		Product:  product,
+		Quantity: int64(quantity),
+		Payment:  int64(payment),
+		Standing: true,
+		Callback: callback,
+	})
+	if err != nil {
+		return Order{}, grpcError(err, ErrUnknownProduct)
+	}
+	return OrderFromProto(resp), nil
+}
+
+func (s *grpcStore) Order(ctx context.Context, id string) (Order, error) {
+	resp, err := s.client.GetOrder(ctx, &shopv1.GetOrderRequest{Id: id})
+	if err != nil {
+		return Order{}, grpcError(err, ErrOrderNotFound)
+	}
+	return OrderFromProto(resp), nil
+}
+
+// grpcError turns the status of a failed call into the errors of a StoreClient. notFound is the error of NOT_FOUND,
+// which means something else for every call. Unavailable stores and timeouts are transport errors.
+func grpcError(err error, notFound error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.ResourceExhausted:
+		for _, detail := range st.Details() {
+			if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == GRPCErrorDomain && info.Reason == ReasonTooManyOrders {
+				return ErrTooManyOrders
+			}
+		}
+		return ErrNotEnoughInventory
+	case codes.FailedPrecondition:
+		return ErrInsufficientPayment
+	case codes.NotFound:
+		if notFound != nil {
+			return notFound
+		}
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return err
+	}
+	return fmt.Errorf("%w: %s: %s", ErrStoreStatus, st.Code(), st.Message())
+}
+
+// OrderToProto returns the Shop service message of an order
+func OrderToProto(order Order) *shopv1.Order {
+	msg := &shopv1.Order{
+		Id:       order.ID,
+		Product:  order.Product,
+		Quantity: int64(order.Quantity),
+		Payment:  int64(order.Payment),
+		Callback: order.Callback,
+		Buyer:    order.Buyer,
+		Price:    int64(order.Price),
+		Total:    int64(order.Total),
+		Reason:   order.Reason,
+		Created:  timestamppb.New(order.Created),
+	}
+	switch order.Status {
+	case OrderPending:
+		msg.Status = shopv1.OrderStatus_ORDER_STATUS_PENDING
+	case OrderFilled:
+		msg.Status = shopv1.OrderStatus_ORDER_STATUS_FILLED
+	case OrderCancelled:
+		msg.Status = shopv1.OrderStatus_ORDER_STATUS_CANCELLED
+	}
+	if order.Settled != nil {
+		msg.Settled = timestamppb.New(*order.Settled)
+	}
+	return msg
+}
+
+// OrderFromProto returns the order of a Shop service message
+func OrderFromProto(msg *shopv1.Order) Order {
+	order := Order{
+		ID:       msg.Id,
+		Product:  msg.Product,
+		Quantity: int(msg.Quantity),
+		Payment:  int(msg.Payment),
+		Callback: msg.Callback,
+		Buyer:    msg.Buyer,
+		Price:    int(msg.Price),
+		Total:    int(msg.Total),
+		Reason:   msg.Reason,
+		Created:  msg.Created.AsTime(),
+	}
+	switch msg.Status {
+	case shopv1.OrderStatus_ORDER_STATUS_PENDING:
+		order.Status = OrderPending
+	case shopv1.OrderStatus_ORDER_STATUS_FILLED:
+		order.Status = OrderFilled
+	case shopv1.OrderStatus_ORDER_STATUS_CANCELLED:
+		order.Status = OrderCancelled
+	}
+	if msg.Settled != nil {
+		settled := msg.Settled.AsTime()
+		order.Settled = &settled
+	}
+	return order
+}
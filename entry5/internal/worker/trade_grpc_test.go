@@ -0,0 +1,224 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	shopv1 "github.com/Potokar1/k8s-research/entry5/internal/apis/shop/v1"
+	"github.com/Potokar1/k8s-research/entry5/internal/auth"
+	"github.com/Potokar1/k8s-research/entry5/internal/server"
+	"github.com/Potokar1/k8s-research/entry5/internal/worker"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// serveGRPC serves the Shop service of the store over an in-memory connection. It returns the client a buyer
+// trades with the store through as grpc://woodworker, and a raw client of the Shop service.
+func serveGRPC(t *testing.T, store *worker.Worker, authenticator *auth.Authenticator) (worker.StoreClient, shopv1.ShopClient, *grpc.Server) {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	srv := server.NewServer(store)
+	srv.SetAuthenticator(authenticator)
+	grpcSrv := grpc.NewServer()
+	srv.InitializeGRPC(grpcSrv)
+	go grpcSrv.Serve(listener)
+	t.Cleanup(grpcSrv.Stop)
+	dial := func(ctx context.Context, address string) (net.Conn, error) { return listener.DialContext(ctx) }
+
+	buyer := worker.NewWorker("kingdom-of-foobar", "craftsman-0", nil, 1000, nil)
+	buyer.SetGRPCDialer(dial)
+	client, err := worker.StoreClientOf(buyer, "grpc://woodworker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.NewClient("passthrough:///woodworker", grpc.WithContextDialer(dial), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return client, shopv1.NewShopClient(conn), grpcSrv
+}
+
+func newWoodworker(stock int) *worker.Worker {
+	store := worker.NewWorker("kingdom-of-foobar", "woodworker-0", []worker.Direction{{Product: "wood", Amount: 1, Interval: 1, Price: 1}}, 0, nil)
+	worker.AddInventory(store, context.Background(), "wood", stock)
+	return store
+}
+
+func TestGRPCStoreSell(t *testing.T) {
+	ctx := context.Background()
+	client, _, _ := serveGRPC(t, newWoodworker(10), nil)
+
+	receipt, err := client.Sell(ctx, "wood", 2, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Item != "wood" || receipt.Quantity != 2 || receipt.Total != 2*receipt.Price || receipt.Price <= 0 {
+		t.Errorf("receipt = %+v, want 2 wood charged at the price", receipt)
+	}
+	prices, err := client.Prices(ctx)
+	if err != nil || prices["wood"] <= 0 {
+		t.Errorf("prices = %v, %v, want the price of wood", prices, err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		product  string
+		quantity int
+		payment  int
+		want     error
+	}{
+		{"unknown product", "iron", 1, 100, worker.ErrUnknownProduct},
+		{"out of stock", "wood", 1000, 100000, worker.ErrNotEnoughInventory},
+		{"insufficient payment", "wood", 1, 0, worker.ErrInsufficientPayment},
+		{"invalid quantity", "wood", 0, 100, worker.ErrStoreStatus},
+	} {
+		if _, err := client.Sell(ctx, tt.product, tt.quantity, tt.payment); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Sell = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestGRPCStoreOrders(t *testing.T) {
+	ctx := context.Background()
+	client, _, _ := serveGRPC(t, newWoodworker(10), nil)
+
+	filled, err := client.PlaceOrder(ctx, "wood", 2, 100, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filled.Status != worker.OrderFilled || filled.Quantity != 2 || filled.Total <= 0 {
+		t.Errorf("order = %+v, want it filled from the stock", filled)
+	}
+	pending, err := client.PlaceOrder(ctx, "wood", 50, 10000, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, err := client.Order(ctx, pending.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != worker.OrderPending || order.Product != "wood" || order.Quantity != 50 || order.Payment != 10000 {
+		t.Errorf("order = %+v, want the pending order as placed", order)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		product  string
+		quantity int
+		want     error
+	}{
+		{"unknown product", "iron", 1, worker.ErrUnknownProduct},
+		{"too large", "wood", 101, worker.ErrStoreStatus},
+	} {
+		if _, err := client.PlaceOrder(ctx, tt.product, tt.quantity, 100000, ""); !errors.Is(err, tt.want) {
+			t.Errorf("%s: PlaceOrder = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	// the younger orders wait behind the large one, the buyer runs into the cap of pending orders
+	var capped error
+	for range 5 {
+		if _, capped = client.PlaceOrder(ctx, "wood", 1, 100, ""); capped != nil {
+			break
+		}
+	}
+	if !errors.Is(capped, worker.ErrTooManyOrders) {
+		t.Errorf("PlaceOrder past the cap = %v, want ErrTooManyOrders rather than out of stock", capped)
+	}
+	if _, err := client.Order(ctx, "ord_0"); !errors.Is(err, worker.ErrOrderNotFound) {
+		t.Errorf("Order(ord_0) = %v, want ErrOrderNotFound", err)
+	}
+}
+
+// TestShopStatusCodes checks the status codes the Shop service answers with, the counterpart of the REST statuses
+func TestShopStatusCodes(t *testing.T) {
+	ctx := context.Background()
+	_, shop, _ := serveGRPC(t, newWoodworker(10), nil)
+
+	for _, tt := range []struct {
+		name   string
+		call   func() error
+		code   codes.Code
+		reason string // reason is the reason of the ErrorInfo detail, empty for none
+	}{
+		{"unknown product", func() error {
+			_, err := shop.Sell(ctx, &shopv1.SellRequest{Product: "iron", Quantity: 1, Payment: 100})
+			return err
+		}, codes.NotFound, ""},
+		{"out of stock", func() error {
+			_, err := shop.Sell(ctx, &shopv1.SellRequest{Product: "wood", Quantity: 1000, Payment: 100000})
+			return err
+		}, codes.ResourceExhausted, ""},
+		{"insufficient payment", func() error {
+			_, err := shop.PlaceOrder(ctx, &shopv1.PlaceOrderRequest{Product: "wood", Quantity: 1, Payment: 0})
+			return err
+		}, codes.FailedPrecondition, ""},
+		{"invalid quantity", func() error {
+			_, err := shop.Sell(ctx, &shopv1.SellRequest{Product: "wood", Quantity: 0, Payment: 100})
+			return err
+		}, codes.InvalidArgument, ""},
+		{"too large order", func() error {
+			_, err := shop.PlaceOrder(ctx, &shopv1.PlaceOrderRequest{Product: "wood", Quantity: 101, Payment: 100000, Standing: true})
+			return err
+		}, codes.InvalidArgument, ""},
+		// the pending orders hold the stock back from the spot sales, so they come after them
+		{"too many orders", func() error {
+			if _, err := shop.PlaceOrder(ctx, &shopv1.PlaceOrderRequest{Product: "wood", Quantity: 50, Payment: 10000, Standing: true}); err != nil {
+				return err
+			}
+			for {
+				if _, err := shop.PlaceOrder(ctx, &shopv1.PlaceOrderRequest{Product: "wood", Quantity: 1, Payment: 100, Standing: true}); err != nil {
+					return err
+				}
+			}
+		}, codes.ResourceExhausted, worker.ReasonTooManyOrders},
+		{"unknown order", func() error {
+			_, err := shop.GetOrder(ctx, &shopv1.GetOrderRequest{Id: "ord_0"})
+			return err
+		}, codes.NotFound, ""},
+	} {
+		st := status.Convert(tt.call())
+		if st.Code() != tt.code {
+			t.Errorf("%s: code %s, want %s", tt.name, st.Code(), tt.code)
+			continue
+		}
+		var reason string
+		for _, detail := range st.Details() {
+			if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == worker.GRPCErrorDomain {
+				reason = info.Reason
+			}
+		}
+		if reason != tt.reason {
+			t.Errorf("%s: reason %q, want %q", tt.name, reason, tt.reason)
+		}
+	}
+}
+
+func TestGRPCStoreTurnedAway(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset()
+	authenticator := auth.NewAuthenticator(clientset.AuthenticationV1().TokenReviews(), clientset.CoreV1(), auth.ModeEnforce, auth.Policy{})
+	client, shop, grpcSrv := serveGRPC(t, newWoodworker(10), authenticator)
+
+	// the buyer has no token: the store answers, it only turns the buyer away
+	if _, err := shop.Sell(ctx, &shopv1.SellRequest{Product: "wood", Quantity: 1, Payment: 100}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Sell without a token = %v, want Unauthenticated", err)
+	}
+	if _, err := client.Sell(ctx, "wood", 1, 100); !errors.Is(err, worker.ErrStoreStatus) {
+		t.Errorf("Sell without a token = %v, want ErrStoreStatus", err)
+	}
+
+	// a store that is gone is not a store that answered
+	grpcSrv.Stop()
+	_, err := client.Sell(ctx, "wood", 1, 100)
+	if errors.Is(err, worker.ErrStoreStatus) || status.Code(err) != codes.Unavailable {
+		t.Errorf("Sell from a stopped store = %v, want Unavailable as it is", err)
+	}
+}
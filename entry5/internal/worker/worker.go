@@ -1,111 +1,348 @@
 package worker
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"maps"
 	"net/http"
-	"os"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/Potokar1/k8s-research/entry5/internal/k8s"
+	"github.com/Potokar1/k8s-research/entry5/internal/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracer starts the spans of the worker, it exports nothing until a tracer provider is installed
+var tracer = otel.Tracer("github.com/Potokar1/k8s-research/entry5/internal/worker")
+
 type Worker struct {
 	kingdom string // Kingdom is the namespace the worker belongs to
 	name    string // Name is the name of the pod
 
 	directions []Direction
 
-	inventoryLock sync.RWMutex
-	inventory     map[string]int
+	store   InventoryStore // store persists the inventory, nil disables persistence
+	pricing *PricingEngine // pricing sets the price of the products from supply and demand
+
+	inventory *Inventory
+
+	clock     clock.Clock  // clock tells the time and waits out the intervals
+	client    *http.Client // client buys from the stores
+	discovery Discovery    // discovery finds the stores of the inputs that discover them, nil finds none
+	sourcing  *sourcing    // sourcing remembers how the stores answered, to pick one and skip failing ones
+
+	storeClients *storeClients // storeClients trade with the stores, over HTTP or gRPC
+
+	orders      *orderBook // orders are the orders of buyers, waiting for stock or settled
+	purchases   *purchases // purchases are the standing orders the worker placed with its stores
+	callbackURL string     // callbackURL is where stores post the settled standing orders of the worker
+
+	stream *stream // stream keeps the latest changes of the worker for /events
+
+	walletLock sync.Mutex
+	wallet     int // wallet is the amount of coins the worker owns
+	// startingCoins are the coins of a worker that found no ledger to restore, given back with the first ledger it claims
+	startingCoins int
+
+	rejectedLock sync.Mutex
+	rejected     map[string]int // rejected counts the units buyers asked for that were out of stock, by product
+
+	producedLock sync.Mutex
+	lastProduced map[string]time.Time // lastProduced is when each product was last made
+
+	dirty            atomic.Int64  // dirty counts the changes to the ledger that are not saved yet
+	publishThreshold atomic.Int64  // publishThreshold is the number of changes that wake the publisher
+	publishNow       chan struct{} // publishNow wakes the publisher before its interval
+
+	metrics *Metrics
+	events  EventRecorder   // events records notable things, such as Kubernetes Events on the pod
+	minimum *minimumTracker // minimum tracks which products are below their minimum
 }
 
 type ProductInput struct {
-	Product string // Product is the name of the product to buy
-	Store   string // Store is the URL of the store to buy from
-	Amount  int    // Amount is the quantity of the product to buy
+	Product  string   `json:"product"`            // Product is the name of the product to buy
+	Store    string   `json:"store,omitempty"`    // Store is the URL of the store to buy from
+	Stores   []string `json:"stores,omitempty"`   // Stores are more stores to buy from, after Store
+	Discover bool     `json:"discover,omitempty"` // Discover buys from every shop in the kingdom that makes the product, after the listed stores
+	Strategy Strategy `json:"strategy,omitempty"` // Strategy picks the store to buy from first, first-in-stock by default
+	Standing bool     `json:"standing,omitempty"` // Standing places an order the store delivers when it has stock, instead of buying on the spot
+	Amount   int      `json:"amount"`             // Amount is the quantity of the product to buy
 }
 
 // Direction is a struct that represents what a worker can do and how often
 type Direction struct {
-	Product          string         // Product is the name of the product to produce
-	ProductInputList []ProductInput // ProductInputList is a list of inputs required to produce the product
-	Amount           int            // Amount is the amount of product to produce at each interval
-	Minimum          int            // Minimum is the minimum amount of product to keep in inventory
-	Interval         int            // Interval is the rate in seconds at which the product should be produced
+	Product          string         `json:"product"`                    // Product is the name of the product to produce
+	ProductInputList []ProductInput `json:"productInputList,omitempty"` // ProductInputList is a list of inputs required to produce the product
+	Amount           int            `json:"amount"`                     // Amount is the amount of product to produce at each interval
+	Minimum          int            `json:"minimum,omitempty"`          // Minimum is the minimum amount of product to keep in inventory
+	Interval         int            `json:"interval"`                   // Interval is the rate in seconds at which the product should be produced
+	Price            int            `json:"price,omitempty"`            // Price is the amount of coins charged for each unit of product sold
 }
 
-func NewWorker(kingdom, name string, directions []Direction) *Worker {
-	return &Worker{
-		kingdom:    kingdom,
-		name:       name,
-		inventory:  make(map[string]int),
-		directions: directions,
+var (
+	// ErrNotEnoughInventory is returned when a sale can't be fulfilled from the inventory
+	ErrNotEnoughInventory = errors.New("not enough inventory")
+	// ErrInsufficientPayment is returned when a buyer can't pay for a sale
+	ErrInsufficientPayment = errors.New("insufficient payment")
+	// ErrUnknownProduct is returned for a sale or an order of a product the worker doesn't make
+	ErrUnknownProduct = errors.New("the worker does not make the product")
+)
+
+// NewWorker creates a worker that starts with the given amount of coins in its wallet
+func NewWorker(kingdom, name string, directions []Direction, coins int, store InventoryStore) *Worker {
+	w := &Worker{
+		kingdom:      kingdom,
+		name:         name,
+		inventory:    NewInventory(),
+		wallet:       coins,
+		directions:   directions,
+		store:        store,
+		pricing:      NewPricingEngine(directions),
+		rejected:     make(map[string]int),
+		lastProduced: make(map[string]time.Time),
+		clock:        clock.Real{},
+		client:       http.DefaultClient,
+		sourcing:     newSourcing(),
+		orders:       newOrderBook(),
+		stream:       newStream(),
+		storeClients: &storeClients{clients: make(map[string]StoreClient)},
+		purchases:    &purchases{orders: make(map[string]*purchase)},
+		publishNow:   make(chan struct{}, 1),
+		events:       noEvents{},
+		minimum:      newMinimumTracker(directions),
 	}
+	w.metrics = newMetrics(w)
+	return w
 }
 
-func (w *Worker) UpdateStoreLog(ctx context.Context) error {
-	// Get inventory list
-	invList := w.InventoryList()
+// RegisterMetrics exposes the metrics of the worker through the registerer
+func (w *Worker) RegisterMetrics(reg prometheus.Registerer) error {
+	return w.metrics.register(reg)
+}
 
-	// Patch Pod
-	return k8s.PatchPod(ctx, w.kingdom, w.name, invList)
+// Restore rehydrates the inventory and wallet from the store, so a restarted worker keeps its stock and coins
+func (w *Worker) Restore(ctx context.Context) error {
+	if w.store == nil {
+		return nil
+	}
+	ledger, err := w.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if ledger == nil {
+		// nothing saved yet, keep the starting coins until a ledger is handed over
+		w.walletLock.Lock()
+		w.startingCoins = w.wallet
+		w.walletLock.Unlock()
+		return nil
+	}
+
+	w.inventory.Replace(ledger.Inventory)
+	w.walletLock.Lock()
+	w.wallet = ledger.Wallet
+	w.walletLock.Unlock()
+
+	w.checkMinimum()
+	w.markDirty() // publish the restored ledger, for stores other than the one it came from
+
+	slog.InfoContext(ctx, "Restored inventory", "inventory", ledger.Inventory, "wallet", ledger.Wallet)
+	return nil
 }
 
-func (w *Worker) addInventory(ctx context.Context, item string, amount int) {
-	w.inventoryLock.Lock()
-	if _, exists := w.inventory[item]; !exists {
-		w.inventory[item] = amount
+// Release hands the ledger over to the next worker of the shop, when the store supports it.
+// It is called once the last changes are saved, the worker must not save again afterwards.
+func (w *Worker) Release(ctx context.Context) error {
+	handover, ok := w.store.(Handover)
+	if !ok {
+		return nil
 	}
-	w.inventory[item] += amount
-	w.inventoryLock.Unlock()
+	return handover.Release(ctx)
+}
 
-	// patch the pod with the new inventory
-	if err := w.UpdateStoreLog(ctx); err != nil {
-		slog.ErrorContext(ctx, "failed to update store log", "error", err)
+// claimReleased takes over a ledger released by a stopped worker of the shop, adding its stock and coins.
+// The coins this worker started with are given back, so a rollout moves the coins instead of creating more.
+func (w *Worker) claimReleased(ctx context.Context, handover Handover) error {
+	ledger, err := handover.Claim(ctx)
+	if err != nil || ledger == nil {
+		return err
+	}
+	w.walletLock.Lock()
+	w.wallet = max(w.wallet+ledger.Wallet-w.startingCoins, 0)
+	w.startingCoins = 0
+	w.walletLock.Unlock()
+	for _, product := range slices.Sorted(maps.Keys(ledger.Inventory)) {
+		if amount := ledger.Inventory[product]; amount > 0 {
+			w.addInventory(ctx, product, amount)
+		}
 	}
+	w.markDirty()
+
+	slog.InfoContext(ctx, "Claimed the inventory of a stopped worker", "inventory", ledger.Inventory, "wallet", ledger.Wallet)
+	return nil
 }
 
-func (w *Worker) ifEnoughInventory(ctx context.Context, item string, amount int) bool {
-	w.inventoryLock.RLock()
-	defer w.inventoryLock.RUnlock()
-	if _, exists := w.inventory[item]; !exists {
-		slog.DebugContext(ctx, "Attempted to check inventory for item that does not exist", "item", item)
-		return false
+func (w *Worker) UpdateStoreLog(ctx context.Context) error {
+	if w.store == nil {
+		return nil
 	}
-	if w.inventory[item] < amount {
-		slog.DebugContext(ctx, "Not enough inventory for item", "item", item, "requested_amount", amount, "available_amount", w.inventory[item])
-		return false
+
+	// Save a copy of the ledger to the store (the pod annotations, a ConfigMap or a file)
+	ledger := w.Ledger()
+	ledger.Prices = w.pricing.Prices(ledger.Inventory)
+	start := time.Now()
+	err := w.store.Save(ctx, ledger)
+	w.metrics.storeSaveDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		w.metrics.storeSaveErrors.Inc()
 	}
-	return true
+	return err
 }
 
-// returns true if item was removed from inventory, false if failure
-func (w *Worker) removeInventory(ctx context.Context, item string, amount int) bool {
-	if !w.ifEnoughInventory(ctx, item, amount) {
-		return false
+// Ledger returns a copy of the inventory and the wallet of the worker
+func (w *Worker) Ledger() Ledger {
+	return Ledger{
+		Inventory: w.inventory.Snapshot(),
+		Wallet:    w.Wallet(),
+		Rejected:  w.Rejected(),
+
+		LastProduced: w.LastProduced(),
 	}
-	w.inventoryLock.Lock()
-	w.inventory[item] -= amount
-	slog.DebugContext(ctx, "Removed inventory", "item", item, "amount", amount, "remaining_inventory", w.inventory[item])
-	w.inventoryLock.Unlock()
-
-	// patch the pod with the new inventory
-	if err := w.UpdateStoreLog(ctx); err != nil {
-		slog.ErrorContext(ctx, "failed to update store log", "error", err)
+}
+
+// LastProduced returns when each product was last made
+func (w *Worker) LastProduced() map[string]time.Time {
+	w.producedLock.Lock()
+	defer w.producedLock.Unlock()
+	return maps.Clone(w.lastProduced)
+}
+
+// markProduced records that a product was made now, and returns when it was made before
+func (w *Worker) markProduced(product string) (previous time.Time, ok bool) {
+	now := w.clock.Now()
+	w.producedLock.Lock()
+	defer w.producedLock.Unlock()
+	previous, ok = w.lastProduced[product]
+	w.lastProduced[product] = now
+	return previous, ok
+}
+
+// Prices returns the current price of every product the worker makes
+func (w *Worker) Prices() map[string]int {
+	return w.pricing.Prices(w.inventory.Snapshot())
+}
+
+// Stock returns the units of a product on hand, and how many of them are not held by a sale or production
+func (w *Worker) Stock(product string) (amount, available int) {
+	return w.inventory.Amount(product), w.inventory.Available(product)
+}
+
+// Directions returns a copy of what the worker produces and buys
+func (w *Worker) Directions() []Direction {
+	directions := make([]Direction, len(w.directions))
+	for i, direction := range w.directions {
+		direction.ProductInputList = slices.Clone(direction.ProductInputList)
+		directions[i] = direction
 	}
-	return true
+	return directions
+}
+
+// Rejected returns the units that could not be sold for lack of stock since the worker started, by product
+func (w *Worker) Rejected() map[string]int {
+	w.rejectedLock.Lock()
+	defer w.rejectedLock.Unlock()
+	return maps.Clone(w.rejected)
+}
+
+// Wallet returns the amount of coins the worker owns
+func (w *Worker) Wallet() int {
+	w.walletLock.Lock()
+	defer w.walletLock.Unlock()
+	return w.wallet
+}
+
+// maxRecordedRejection is the most units a single turned down request counts towards the price and the autoscaler,
+// so one buyer asking for a huge quantity can't skew them
+const maxRecordedRejection = 100
+
+// buyHeadroom is how many times the quoted price a purchase sets aside, as the price can rise before the sale
+const buyHeadroom = 2
+
+// budget quotes the price of the input at the store and withdraws what buying it may cost.
+// It returns ErrUnknownProduct when the store has no price for it, and ErrInsufficientPayment when the wallet can't cover the quote.
+func (w *Worker) budget(ctx context.Context, client StoreClient, item ProductInput) (int, error) {
+	prices, err := client.Prices(ctx)
+	if err != nil {
+		return 0, err
+	}
+	price, ok := prices[item.Product]
+	if !ok {
+		return 0, ErrUnknownProduct
+	}
+	cost := price * item.Amount
+	w.walletLock.Lock()
+	defer w.walletLock.Unlock()
+	if cost > w.wallet {
+		return 0, ErrInsufficientPayment
+	}
+	payment := min(cost*buyHeadroom, w.wallet)
+	w.wallet -= payment
+	return payment, nil
+}
+
+// deposit puts coins into the wallet
+func (w *Worker) deposit(amount int) {
+	w.walletLock.Lock()
+	w.wallet += amount
+	w.walletLock.Unlock()
+}
+
+func (w *Worker) addInventory(ctx context.Context, item string, amount int) {
+	w.inventory.Add(item, amount)
+	w.checkMinimum()
+	w.streamInventory(map[string]int{item: amount}, 1)
+
+	// the publisher saves the new inventory
+	w.markDirty()
+
+	// standing orders get the new stock before anyone else
+	w.fillOrders(ctx, item, nil)
+}
+
+// commitReservation removes reserved items from the inventory and publishes the change
+func (w *Worker) commitReservation(ctx context.Context, reservation *Reservation) {
+	ctx, span := tracer.Start(ctx, "Worker.commitReservation")
+	defer span.End()
+
+	reservation.Commit()
+	w.checkMinimum()
+	w.streamInventory(reservation.items, -1)
+
+	// the publisher saves the new inventory
+	w.markDirty()
 }
 
 // BuyRequest is the data payload received by another service to buy an item
 type BuyRequest struct {
 	Item     string `json:"item"`
 	Quantity int    `json:"quantity"`
+	Payment  int    `json:"payment"` // Payment is the most the buyer is willing to pay, the change is returned in the Receipt
+}
+
+// Receipt is the data payload returned to the buyer after a successful sale
+type Receipt struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+	Price    int    `json:"price"` // Price is the price of a single unit
+	Total    int    `json:"total"` // Total is the amount of coins charged for the sale
 }
 
 // DecodeBuyRequest json decodes the request body into a BuyRequest struct
@@ -117,149 +354,186 @@ func DecodeBuyRequest(r *http.Request) (*BuyRequest, error) {
 	return &req, nil
 }
 
-// buy allows the worker to buy a product from a store given the ProductInput
-// buy is expected to only be called by a locked worker.
-func (w *Worker) buy(ctx context.Context, item ProductInput) bool {
-	// create a buy request for the item
-	BuyRequest := BuyRequest{
-		Item:     item.Product,
-		Quantity: item.Amount,
-	}
+// buy allows the worker to buy a product from the store of the ProductInput.
+// It returns ErrNotEnoughInventory, ErrInsufficientPayment or ErrUnknownProduct when the store turned the sale down,
+// and any other error when the store could not be reached or answered wrong.
+func (w *Worker) buy(ctx context.Context, item ProductInput) (err error) {
+	ctx, span := tracer.Start(ctx, "Worker.buy", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("civ.product", item.Product),
+		attribute.Int("civ.amount", item.Amount),
+		attribute.String("civ.store", item.Store),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Bool("civ.bought", err == nil))
+		span.End()
+	}()
 
-	// Marshal the BuyRequest into JSON
-	payload, err := json.Marshal(BuyRequest)
+	// buy from the store over HTTP or gRPC, depending on its URL
+	client, err := w.storeClient(item.Store)
 	if err != nil {
-		slog.ErrorContext(ctx, "failed to marshal BuyRequest", "error", err)
-		return false
+		w.buyFailed(item, BuyFailureTransport, err.Error())
+		return err
 	}
 
-	// create a new reader for the payload
-	reader := bytes.NewReader(payload)
-
-	// Make a request to the store to buy the product
-	req, err := http.NewRequest("POST", item.Store+"/sell", reader)
-	if err != nil {
-		slog.ErrorContext(ctx, "failed to create HTTP request", "error", err)
-		return false
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		slog.WarnContext(ctx, "failed to send HTTP request", "error", err)
-		return false
-	}
+	// take only the budget for the quoted price out of the wallet while the request is in flight, the change is returned after the sale
+	payment, err := w.budget(ctx, client, item)
+	refund := payment
 	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			slog.ErrorContext(ctx, "failed to close response body", "error", err)
+		if refund > 0 {
+			w.deposit(refund)
 		}
 	}()
-
-	switch resp.StatusCode {
-	case http.StatusConflict:
-		// Conflict means the store could not fulfill the request due to insufficient inventory
-		slog.DebugContext(ctx, "store could not fulfill buy request due to insufficient inventory")
-		return false
-	case http.StatusOK:
-		// if the request was successful, we assume the item was bought
+	var receipt Receipt
+	if err == nil {
+		receipt, err = client.Sell(ctx, item.Product, item.Amount, payment)
+	}
+	switch {
+	case err == nil:
+		// the store charged us for the item, keep the change
+		paid := min(receipt.Total, payment)
+		w.deposit(payment - paid)
+		refund = 0
 		w.addInventory(ctx, item.Product, item.Amount)
-		slog.InfoContext(ctx, "Purchased", "product", item.Product, "amount", item.Amount)
-		return true
+		w.metrics.bought.WithLabelValues(item.Product).Add(float64(item.Amount))
+		w.streamEvent(StreamEvent{Kind: StreamBought, Product: item.Product, Amount: item.Amount, Total: paid})
+		slog.InfoContext(ctx, "Purchased", "product", item.Product, "amount", item.Amount, "total", paid, "store", item.Store)
+		return nil
+	case errors.Is(err, ErrNotEnoughInventory):
+		w.buyFailed(item, BuyFailureConflict, "the store is out of stock")
+		slog.DebugContext(ctx, "store could not fulfill buy request due to insufficient inventory")
+		return err
+	case errors.Is(err, ErrUnknownProduct):
+		w.buyFailed(item, BuyFailureUnknownProduct, "the store does not make it")
+		slog.DebugContext(ctx, "store does not sell the product", "product", item.Product, "store", item.Store)
+		return err
+	case errors.Is(err, ErrInsufficientPayment):
+		w.buyFailed(item, BuyFailurePaymentRequired, fmt.Sprintf("%d coins is not enough", max(payment, w.Wallet())))
+		slog.DebugContext(ctx, "could not afford buy request", "product", item.Product, "payment", payment, "wallet", w.Wallet(), "store", item.Store)
+		return err
+	case errors.Is(err, ErrStoreStatus):
+		w.buyFailed(item, BuyFailureStatus, err.Error())
+		span.SetStatus(codes.Error, err.Error())
+		slog.DebugContext(ctx, "store answered with an error", "error", err, "store", item.Store)
+		return err
 	default:
-		// any other non-200 status code is treated as an error
-		slog.DebugContext(ctx, "received non-200 status code from store", "status_code", resp.StatusCode, "store", item.Store)
-		return false
+		span.SetStatus(codes.Error, err.Error())
+		w.buyFailed(item, BuyFailureTransport, err.Error())
+		slog.WarnContext(ctx, "failed to reach the store", "error", err, "store", item.Store)
+		return err
+	}
+}
+
+// buyFailed counts a failed buy and records a PurchaseFailed event
+func (w *Worker) buyFailed(item ProductInput, reason string, detail string) {
+	w.metrics.buyFailures.WithLabelValues(item.Product, reason).Inc()
+	w.events.Event(EventTypeWarning, ReasonPurchaseFailed,
+		fmt.Sprintf("failed to buy %d %s from %s: %s", item.Amount, item.Product, item.Store, detail))
+}
+
+// Sell removes the items from the inventory and charges the buyer for them.
+// The payment is the most the buyer is willing to pay, only the total in the receipt is kept.
+// The price is set by the pricing engine, and every sale or rejection feeds back into it.
+func (w *Worker) Sell(ctx context.Context, item string, quantity int, payment int) (*Receipt, error) {
+	if !w.makes(item) {
+		return nil, ErrUnknownProduct
+	}
+	// the price is set by the stock before the sale
+	price := w.pricing.Price(item, w.inventory.Available(item))
+
+	// hold the items so no other sale can take them while the buyer pays, standing orders keep what they wait for
+	reservation, err := w.inventory.ReserveKeeping(map[string]int{item: quantity}, map[string]int{item: w.heldForOrders(item)})
+	if err != nil {
+		rejected := min(max(quantity, 0), maxRecordedRejection)
+		w.pricing.RecordRejection(item, rejected)
+		w.rejectedLock.Lock()
+		w.rejected[item] += rejected
+		w.rejectedLock.Unlock()
+		w.events.Event(EventTypeWarning, ReasonOutOfStock,
+			fmt.Sprintf("out of %s: %d requested, %d available", item, quantity, w.inventory.Available(item)))
+		slog.DebugContext(ctx, "Not enough inventory for item", "item", item, "requested_amount", quantity, "available_amount", w.inventory.Available(item))
+		return nil, err
+	}
+
+	receipt := &Receipt{
+		Item:     item,
+		Quantity: quantity,
+		Price:    price,
+		Total:    price * quantity,
 	}
+	if payment < receipt.Total {
+		reservation.Release()
+		slog.DebugContext(ctx, "Buyer can not pay for sale", "item", item, "total", receipt.Total, "payment", payment)
+		return nil, ErrInsufficientPayment
+	}
+
+	w.deposit(receipt.Total)
+	w.pricing.RecordSale(item, quantity)
+	w.commitReservation(ctx, reservation)
+	w.metrics.sold.WithLabelValues(item).Add(float64(quantity))
+	w.streamEvent(StreamEvent{Kind: StreamSold, Product: item, Amount: quantity, Total: receipt.Total})
+	slog.DebugContext(ctx, "Sold inventory", "item", item, "amount", quantity, "total", receipt.Total, "remaining_inventory", w.inventory.Amount(item))
+	return receipt, nil
 }
 
-func (w *Worker) Sell(ctx context.Context, item string, quantity int) bool {
-	return w.removeInventory(ctx, item, quantity)
+// makes returns whether the directions of the worker produce the product
+func (w *Worker) makes(product string) bool {
+	return slices.ContainsFunc(w.directions, func(d Direction) bool { return d.Product == product })
 }
 
 func (w *Worker) AboveMinimum() bool {
-	w.inventoryLock.RLock()
-	defer w.inventoryLock.RUnlock()
+	inventory := w.inventory.Snapshot()
 	for _, direction := range w.directions {
-		if w.inventory[direction.Product] < direction.Minimum {
+		if inventory[direction.Product] < direction.Minimum {
 			return false
 		}
 	}
 	return true
 }
 
-func (w *Worker) InventoryList() map[string]string {
-	w.inventoryLock.RLock()
-	invList := make(map[string]int, len(w.inventory))
-	maps.Copy(invList, w.inventory)
-	w.inventoryLock.RUnlock()
-
-	invListStr := make(map[string]string, len(invList))
-	for item, amount := range invList {
-		invListStr[item] = fmt.Sprintf("%d", amount)
-	}
-
-	return invListStr
-}
+// produce increments the inventory of a product by a set amount, or buys the first missing input.
+// The kept inputs are held for other directions, they can't be used to produce. It returns whether the product was made.
+func (w *Worker) produce(ctx context.Context, direction Direction, keep map[string]int) (produced bool) {
+	ctx, span := tracer.Start(ctx, "Worker.produce", trace.WithAttributes(
+		attribute.String("civ.product", direction.Product),
+	))
+	defer span.End()
 
-// produce increments the inventory of a product by a set amount
-func (w *Worker) produce(ctx context.Context, direction Direction) {
-	// check that we have enough inventory to produce the product
+	// reserve every input in one step, so a sale can't take an input halfway through production
+	inputs := make(map[string]int, len(direction.ProductInputList))
 	for _, input := range direction.ProductInputList {
-		if !w.ifEnoughInventory(ctx, input.Product, input.Amount) {
-			// attempt to buy the missing inputs
-			if bought := w.buy(ctx, input); !bought {
-				slog.DebugContext(ctx, "failed to buy input", "product", input.Product, "store", input.Store, "amount", input.Amount)
+		inputs[input.Product] += input.Amount
+	}
+	reservation, err := w.inventory.ReserveKeeping(inputs, keep)
+	if err != nil {
+		// attempt to buy the first missing input
+		for _, input := range direction.ProductInputList {
+			if w.inventory.Available(input.Product) >= inputs[input.Product]+keep[input.Product] {
+				continue
+			}
+			if bought := w.source(ctx, input); !bought {
+				slog.DebugContext(ctx, "failed to buy input", "product", input.Product, "amount", input.Amount)
+			} else {
+				slog.DebugContext(ctx, "Bought product input", "product", direction.Product, "input", input.Product, "amount", input.Amount)
 			}
-			slog.DebugContext(ctx, "Bought product input from store", "product", direction.Product, "input", input.Product, "store", input.Store, "amount", input.Amount)
 			// only let the workers do one action at a time, so return early
-			return
+			return false
 		}
+		return false
 	}
 
 	// use inputs to make the product
-	for _, input := range direction.ProductInputList {
-		if !w.removeInventory(ctx, input.Product, input.Amount) {
-			slog.WarnContext(ctx, "not enough inventory to produce product", "product", direction.Product, "input", input.Product, "amount", input.Amount)
-			return // if we can't remove the input, we can't produce the product
-		}
-	}
+	w.commitReservation(ctx, reservation)
 
 	// increment the inventory of the product. This is the worker producing the product
+	previous, ok := w.markProduced(direction.Product)
 	w.addInventory(ctx, direction.Product, direction.Amount)
-	slog.InfoContext(ctx, "Produced product", "product", direction.Product, "amount", direction.Amount)
-}
-
-// Work is the loop that will run the worker until the context is canceled
-func (w *Worker) Work(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			for _, direction := range w.directions {
-				select {
-				case <-time.After(time.Duration(direction.Interval) * time.Second):
-					w.produce(ctx, direction)
-				case <-ctx.Done():
-					return
-				}
-			}
-			// sleep for a second to prevent a busy loop
-			time.Sleep(1 * time.Second) // This could also be thought of as the time it takes for a worker to do a task (buy or produce)
-		}
-	}
-}
-
-// ParseDirectionsFile reads a json file and returns a slice of Directions
-func ParseDirectionsFile(filename string) ([]Direction, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("error reading worker directions file: %w", err)
-	}
-
-	var directions []Direction
-	if err := json.Unmarshal(data, &directions); err != nil {
-		return nil, fmt.Errorf("error unmarshalling worker directions: %w", err)
+	if ok {
+		w.metrics.productionCycle.WithLabelValues(direction.Product).Observe(w.clock.Now().Sub(previous).Seconds())
 	}
-
-	return directions, nil
+	w.metrics.produced.WithLabelValues(direction.Product).Add(float64(direction.Amount))
+	w.streamEvent(StreamEvent{Kind: StreamProduced, Product: direction.Product, Amount: direction.Amount})
+	span.SetAttributes(attribute.Int("civ.produced", direction.Amount))
+	w.events.Event(EventTypeNormal, ReasonProduced, fmt.Sprintf("produced %d %s", direction.Amount, direction.Product))
+	slog.InfoContext(ctx, "Produced product", "product", direction.Product, "amount", direction.Amount)
+	return true
 }
@@ -0,0 +1,315 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Potokar1/k8s-research/entry5/internal/clock"
+)
+
+func TestSellUnknownProduct(t *testing.T) {
+	w := NewWorker("kingdom-of-foobar", "woodworker-0", []Direction{{Product: "wood", Amount: 1, Interval: 1, Price: 2}}, 0, nil)
+	w.addInventory(context.Background(), "iron", 5)
+
+	if _, err := w.Sell(context.Background(), "iron", 1, 100); !errors.Is(err, ErrUnknownProduct) {
+		t.Errorf("Sell(iron) = %v, want ErrUnknownProduct", err)
+	}
+	if got := w.Wallet(); got != 0 {
+		t.Errorf("wallet = %d after refusing the sale, want 0", got)
+	}
+}
+
+func TestBuyWithdrawsBudget(t *testing.T) {
+	w := NewWorker("kingdom-of-foobar", "craftsman-0", nil, 1000, nil)
+	var inFlight, payment int
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /prices", func(rw http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]int{"wood": 5})
+	})
+	mux.HandleFunc("POST /sell", func(rw http.ResponseWriter, r *http.Request) {
+		req, err := DecodeBuyRequest(r)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		inFlight, payment = w.Wallet(), req.Payment
+		json.NewEncoder(rw).Encode(Receipt{Item: req.Item, Quantity: req.Quantity, Price: 5, Total: 5 * req.Quantity})
+	})
+	store := httptest.NewServer(mux)
+	defer store.Close()
+
+	if err := w.buy(context.Background(), ProductInput{Product: "wood", Amount: 2, Store: store.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if payment != 20 || inFlight != 980 {
+		t.Errorf("paid %d with %d left in the wallet, want twice the quote of 10 set aside", payment, inFlight)
+	}
+	if got := w.Wallet(); got != 990 {
+		t.Errorf("wallet = %d after the sale, want the change back", got)
+	}
+}
+
+func TestSellClampsRecordedRejection(t *testing.T) {
+	w := NewWorker("kingdom-of-foobar", "woodworker-0", []Direction{{Product: "wood", Amount: 1, Interval: 1, Price: 2}}, 0, nil)
+
+	if _, err := w.Sell(context.Background(), "wood", 1_000_000, 0); !errors.Is(err, ErrNotEnoughInventory) {
+		t.Fatalf("Sell = %v, want ErrNotEnoughInventory", err)
+	}
+	if got := w.Rejected()["wood"]; got != maxRecordedRejection {
+		t.Errorf("rejected = %d, want it clamped to %d", got, maxRecordedRejection)
+	}
+}
+
+func TestSourceTimeoutOpensBreaker(t *testing.T) {
+	defer func(timeout time.Duration) { storeTimeout = timeout }(storeTimeout)
+	storeTimeout = 50 * time.Millisecond
+
+	release := make(chan struct{})
+	store := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		select { // a store that never answers
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer store.Close()
+	defer close(release)
+
+	w := NewWorker("kingdom-of-foobar", "craftsman-0", nil, 1000, nil)
+	input := ProductInput{Product: "wood", Amount: 1, Store: store.URL}
+	for range breakerThreshold {
+		if w.source(context.Background(), input) {
+			t.Fatal("bought from a store that never answers")
+		}
+	}
+	if w.sourcing.allow(store.URL, w.clock.Now()) {
+		t.Errorf("the breaker of the store is closed after %d timeouts", breakerThreshold)
+	}
+	if got := w.Wallet(); got != 1000 {
+		t.Errorf("wallet = %d, want every budget refunded", got)
+	}
+}
+
+func TestCancelOrderOwner(t *testing.T) {
+	ctx := context.Background()
+	w := NewWorker("kingdom-of-foobar", "woodworker-0", []Direction{{Product: "wood", Amount: 1, Interval: 1, Price: 1}}, 0, nil)
+	order, err := w.PlaceOrder(ctx, "wood", 5, 100, "", "kingdom-of-foobar/craftsman-0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.CancelOrder(ctx, order.ID, "kingdom-of-foobar/ironworker-0"); !errors.Is(err, ErrNotOrderOwner) {
+		t.Errorf("cancel by another buyer = %v, want ErrNotOrderOwner", err)
+	}
+	cancelled, err := w.CancelOrder(ctx, order.ID, "kingdom-of-foobar/craftsman-0")
+	if err != nil || cancelled.Status != OrderCancelled {
+		t.Errorf("cancel by the buyer = %+v, %v, want it cancelled", cancelled, err)
+	}
+}
+
+func TestStandingOrderLimits(t *testing.T) {
+	ctx := context.Background()
+	w := NewWorker("kingdom-of-foobar", "woodworker-0", []Direction{{Product: "wood", Amount: 1, Interval: 1, Price: 1}}, 0, nil)
+
+	if _, err := w.PlaceOrder(ctx, "wood", maxOrderQuantity+1, 1_000_000, "", "kingdom-of-foobar/craftsman-0", true); !errors.Is(err, ErrOrderTooLarge) {
+		t.Errorf("order of %d units = %v, want ErrOrderTooLarge", maxOrderQuantity+1, err)
+	}
+	for range maxPendingOrders {
+		if _, err := w.PlaceOrder(ctx, "wood", 1, 100, "", "kingdom-of-foobar/craftsman-0", true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := w.PlaceOrder(ctx, "wood", 1, 100, "", "kingdom-of-foobar/craftsman-0", true); !errors.Is(err, ErrTooManyOrders) {
+		t.Errorf("order past the limit = %v, want ErrTooManyOrders", err)
+	}
+	if _, err := w.PlaceOrder(ctx, "wood", 1, 100, "", "kingdom-of-foobar/craftsman-1", true); err != nil {
+		t.Errorf("order of another buyer = %v, want it placed", err)
+	}
+}
+
+func TestFillOrdersHoldsForOlderOrders(t *testing.T) {
+	ctx := context.Background()
+	w := NewWorker("kingdom-of-foobar", "woodworker-0", []Direction{{Product: "wood", Amount: 1, Interval: 1, Price: 1}}, 0, nil)
+	large, err := w.PlaceOrder(ctx, "wood", 10, 1_000_000, "", "kingdom-of-foobar/craftsman-0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a small order arrives with every unit produced, none of them may take the units the large order waits for
+	for i := range 10 {
+		if _, err := w.PlaceOrder(ctx, "wood", 1, 1_000_000, "", fmt.Sprintf("kingdom-of-foobar/smith-%d", i), true); err != nil {
+			t.Fatal(err)
+		}
+		if order, _ := w.Order(large.ID); order.Status != OrderPending {
+			t.Fatalf("large order is %s with %d units produced, want it pending", order.Status, i)
+		}
+		w.addInventory(ctx, "wood", 1)
+	}
+	if order, _ := w.Order(large.ID); order.Status != OrderFilled {
+		t.Errorf("large order is %s, want it filled before the younger orders", order.Status)
+	}
+
+	// what the older orders don't need goes to the younger ones
+	w.addInventory(ctx, "wood", 3)
+	filled := 0
+	for _, order := range w.Orders() {
+		if order.Quantity == 1 && order.Status == OrderFilled {
+			filled++
+		}
+	}
+	if filled != 3 {
+		t.Errorf("%d small orders filled, want the 3 units left over to fill 3", filled)
+	}
+}
+
+func TestSellHoldsForOldestOrder(t *testing.T) {
+	ctx := context.Background()
+	w := NewWorker("kingdom-of-foobar", "woodworker-0", []Direction{{Product: "wood", Amount: 1, Interval: 1, Price: 1}}, 0, nil)
+	if _, err := w.PlaceOrder(ctx, "wood", 50, 1_000_000, "", "kingdom-of-foobar/craftsman-0", true); err != nil {
+		t.Fatal(err)
+	}
+
+	// spot sales leave the oldest order its 50 units, but may sell what goes beyond it
+	w.addInventory(ctx, "wood", 49)
+	if _, err := w.Sell(ctx, "wood", 1, 1_000_000); !errors.Is(err, ErrNotEnoughInventory) {
+		t.Errorf("Sell below the held stock = %v, want ErrNotEnoughInventory", err)
+	}
+}
+
+func TestWorkOverlapsDirections(t *testing.T) {
+	blocked := make(chan struct{}, 1)
+	release := make(chan struct{})
+	store := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		select {
+		case blocked <- struct{}{}:
+		default:
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		http.Error(rw, "closed", http.StatusServiceUnavailable)
+	}))
+	defer store.Close()
+	defer close(release)
+
+	directions := []Direction{
+		{Product: "tool", Amount: 1, Interval: 1, ProductInputList: []ProductInput{{Product: "ore", Amount: 1, Store: store.URL}}},
+		{Product: "wood", Amount: 1, Interval: 1},
+		{Product: "stone", Amount: 1, Interval: 1},
+	}
+	w := NewWorker("kingdom-of-foobar", "smith-0", directions, 1000, nil)
+	fast, err := clock.NewScaled(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetClock(fast)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.Work(ctx, ScheduleOptions{})
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	select {
+	case <-blocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tool direction never asked the store for ore")
+	}
+	// the buy of ore hangs, the other directions keep producing meanwhile
+	deadline := time.After(5 * time.Second)
+	for {
+		inventory := w.Ledger().Inventory
+		if inventory["wood"] >= 3 && inventory["stone"] >= 3 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("inventory = %v while the tool direction is blocked on a buy, want wood and stone produced", inventory)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestPlaceOrderDeliversOthers(t *testing.T) {
+	ctx := context.Background()
+	var lock sync.Mutex
+	var delivered []string
+	buyer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var order Order
+		if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+			t.Error(err)
+		}
+		lock.Lock()
+		delivered = append(delivered, order.ID)
+		lock.Unlock()
+	}))
+	defer buyer.Close()
+
+	w := NewWorker("kingdom-of-foobar", "woodworker-0", []Direction{{Product: "wood", Amount: 1, Interval: 1, Price: 1}}, 0, nil)
+	waiting, err := w.PlaceOrder(ctx, "wood", 5, 1_000_000, buyer.URL, "kingdom-of-foobar/craftsman-0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.addInventory(ctx, "wood", 4)
+	// the order placed now fills the waiting one along with itself: only the waiting one is delivered
+	w.inventory.Add("wood", 3)
+	placed, err := w.PlaceOrder(ctx, "wood", 2, 1_000_000, buyer.URL, "kingdom-of-foobar/craftsman-1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placed.Status != OrderFilled {
+		t.Errorf("placed order is %s, want it filled from the stock", placed.Status)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(delivered) != 1 || delivered[0] != waiting.ID {
+		t.Errorf("delivered %v, want only the waiting order %s", delivered, waiting.ID)
+	}
+}
+
+func TestSettledOrdersOutliveLostWindow(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	virtual := clock.NewVirtual(start)
+	w := NewWorker("kingdom-of-foobar", "woodworker-0", []Direction{{Product: "wood", Amount: 1, Interval: 1, Price: 1}}, 0, nil)
+	w.SetClock(virtual)
+	w.inventory.Add("wood", 2000)
+	place := func() Order {
+		t.Helper()
+		order, err := w.PlaceOrder(ctx, "wood", 1, 1_000_000, "", "kingdom-of-foobar/craftsman-0", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return order
+	}
+
+	first := place()
+	// many orders settle after it, a buyer polling within its lost window still finds it
+	virtual.Set(start.Add(orderLostAfter))
+	for range 1200 {
+		place()
+	}
+	if _, err := w.Order(first.ID); err != nil {
+		t.Errorf("order settled %s ago = %v, want it remembered", orderLostAfter, err)
+	}
+
+	virtual.Set(start.Add(settledOrderTTL))
+	place()
+	if _, err := w.Order(first.ID); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("order settled %s ago = %v, want it forgotten", settledOrderTTL, err)
+	}
+}